@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/denis-gudim/moex-history-downloader/internal/history"
+)
+
+func main() {
+	concurrency := flag.Int("concurrency", history.DefaultConcurrency, "number of pairs downloaded in parallel")
+	verbose := flag.Bool("v", false, "verbose output with requested URLs and per month details")
+	quiet := flag.Bool("q", false, "print errors only, e.g. for cron")
+	flag.Parse()
+	logLevel := history.Verbosity(*verbose, *quiet)
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: concurrency must be at least 1")
+		os.Exit(2)
+	}
+
+	// Cancel running downloads on Ctrl-C, incomplete files are discarded
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pairs := []string{
+		"USD000UTSTOM", "EUR_RUB__TOM",
+	}
+
+	// Currency pairs are downloaded month by month like shares
+	opts := history.ProcessOptions{
+		Engine:      history.CurrencyEngine,
+		Market:      history.CurrencyMarket,
+		Board:       history.CurrencyBoard,
+		Writer:      history.DefaultWriter(),
+		Concurrency: *concurrency,
+		LogLevel:    logLevel,
+		Interval:    history.IntervalMinute1,
+	}
+	if logLevel >= history.LogInfo {
+		opts.Progress = history.PrintProgress
+	}
+
+	report, err := history.ProcessShares(ctx, &history.Fetcher{LogLevel: logLevel}, opts, 2020, 2026, pairs...)
+	if report != nil && logLevel >= history.LogInfo {
+		fmt.Println(report.Summary())
+		if tickers := report.UnderCovered(); len(tickers) > 0 {
+			fmt.Printf("Under-covered tickers: %s\n", strings.Join(tickers, ", "))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		stop()
+		os.Exit(1)
+	}
+}
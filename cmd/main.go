@@ -2,124 +2,181 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/denis-gudim/moex-history-downloader/internal/history"
-	"golang.org/x/sync/errgroup"
 )
 
-var (
-	codes = []string{"H", "M", "U", "Z"}
-)
-
-// thirdFriday returns the third Friday of given year and month
-func thirdFriday(year int, month int) time.Time {
-	third := time.Date(year, time.Month(month), 15, 0, 0, 0, 0, time.UTC)
-	weekday := third.Weekday()
-	daysUntilFriday := (5 - weekday + 7) % 7
-	return third.AddDate(0, 0, int(daysUntilFriday))
-}
-
-// createOrAppendFile creates a new file if it doesn't exist or appends to existing one
-func createOrAppendFile(fileName string) (*os.File, error) {
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		return os.Create(fileName)
-	}
-	return os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+var futures = []string{
+	"Si", "BR", "RI", "SR", "GZ", "LK", "MX", "GD", "RN", "VB", "MG", "SN", "NL", "MT", "GM", "TT", "PL", "CH", "YN", "AL", "ME", "FV", "PO", "PH", "TN", "AF", "NV", "PK", "RU", "HY",
 }
 
-// ProcessContracts processes all contracts for given year range
-func ProcessContracts(yearBegin, yearEnd int, contracts ...string) error {
-	currentDir, err := os.Getwd()
+// readTickersFile reads one ticker per line ignoring blank lines and # comments
+func readTickersFile(fileName string) ([]string, error) {
+	content, err := os.ReadFile(fileName)
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return nil, fmt.Errorf("failed to read tickers file: %w", err)
 	}
 
-	gr, _ := errgroup.WithContext(context.Background())
-	gr.SetLimit(4)
-
-	for _, contract := range contracts {
-		gr.Go(func() error {
-			// Create one file per contract
-			fileName := filepath.Join(currentDir, fmt.Sprintf("%s.txt", contract))
-
-			// Remove existing file to start fresh
-			if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("failed to remove existing file: %w", err)
-			}
-
-			// Create new file and write header
-			file, err := os.Create(fileName)
-			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
-			}
-
-			// Write header
-			header := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n"
-			if _, err := file.WriteString(header); err != nil {
-				file.Close()
-				return fmt.Errorf("failed to write header: %w", err)
-			}
-			file.Close()
-
-			fetcher := &history.Fetcher{}
-			for y := yearBegin; y < yearEnd; y++ {
-				for i, code := range codes {
-					m := i*3 + 3
-					yBegin := y
-					mBegin := m - 3
+	var tickers []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if indx := strings.Index(line, "#"); indx >= 0 {
+			line = line[:indx]
+		}
+		if ticker := strings.TrimSpace(line); ticker != "" {
+			tickers = append(tickers, ticker)
+		}
+	}
+	return tickers, nil
+}
 
-					if mBegin == 0 {
-						mBegin = 12
-						yBegin--
-					}
+// parseTickers splits comma separated tickers list, @file reads the list from file
+func parseTickers(value string) ([]string, error) {
+	if strings.HasPrefix(value, "@") {
+		return readTickersFile(strings.TrimPrefix(value, "@"))
+	}
 
-					beginDate := thirdFriday(yBegin, mBegin).AddDate(0, 0, -1)
-					endDate := thirdFriday(y, m).AddDate(0, 0, -2)
-					ticker := fmt.Sprintf("%s%s%d", contract, code, y%10)
+	var tickers []string
+	for _, ticker := range strings.Split(value, ",") {
+		if ticker = strings.TrimSpace(ticker); ticker != "" {
+			tickers = append(tickers, ticker)
+		}
+	}
+	return tickers, nil
+}
 
-					data, err := fetcher.Fetch(context.Background(), "features", "forts", "RFUD", ticker, beginDate, endDate, 1)
-					if err != nil {
-						return fmt.Errorf("failed to get OHLC data for %s: %w", ticker, err)
-					}
+func main() {
+	tickersFlag := flag.String("tickers", "", "comma separated tickers or futures roots, @file reads them from file")
+	tickersFile := flag.String("tickers-file", "", "file with one ticker per line, blank lines and # comments are ignored")
+	fromYear := flag.Int("from-year", 2016, "first year to download")
+	toYear := flag.Int("to-year", 2025, "last year to download")
+	interval := flag.Int("interval", history.IntervalMinute1, "candles interval: 1, 10, 60, 24 (day), 7 (week), 31 (month), 4 (quarter)")
+	kind := flag.String("kind", "", "futures downloads quarterly contracts of roots, shares downloads tickers as is, inferred from -engine when empty")
+	engine := flag.String("engine", "", "ISS engine, e.g. stock or currency, futures by default")
+	market := flag.String("market", "", "ISS market, e.g. shares or selt, default of the engine when empty")
+	board := flag.String("board", "", "ISS board, the first board of the market chain when empty, e.g. TQBR for stock shares")
+	out := flag.String("out", "", "output directory, current directory by default")
+	config := flag.String("config", "", "JSON config file with a list of download jobs or CSV watchlist, overrides instrument flags")
+	concurrency := flag.Int("concurrency", history.DefaultConcurrency, "number of tickers downloaded in parallel")
+	maxClockSkew := flag.Duration("max-clock-skew", time.Minute, "warn when local clock differs from ISS server time by more than this, 0 disables the check")
+	maxRuntime := flag.Duration("max-runtime", 0, "stop downloading after this duration, e.g. 2h, no limit by default")
+	cacheDir := flag.String("cache-dir", "", "directory caching raw ISS responses, no caching by default")
+	refreshCache := flag.Bool("refresh-cache", false, "ignore cached responses and replace them with fresh ones")
+	contract := flag.Bool("contract", false, "prepend <CONTRACT> column identifying futures contract of every row")
+	summary := flag.Bool("summary", false, "write summary.json with per ticker rows, dates, gaps and errors into output directory")
+	clampFirstCandle := flag.Bool("clamp-first-candle", false, "skip months of shares before their first candle, costs a request per share")
+	checksum := flag.Bool("checksum", false, "write <file>.sha256 with checksum and rows count next to every output file")
+	dryRun := flag.Bool("dry-run", false, "print requests and target files without downloading")
+	verbose := flag.Bool("v", false, "verbose output with requested URLs and per period details")
+	quiet := flag.Bool("q", false, "print errors only, e.g. for cron")
+	flag.Parse()
+	logLevel := history.Verbosity(*verbose, *quiet)
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: concurrency must be at least 1")
+		os.Exit(2)
+	}
+	if err := history.ValidateInterval(*interval); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := history.ValidateJobKind(*kind); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
 
-					// Append data to the contract file
-					file, err := createOrAppendFile(fileName)
-					if err != nil {
-						return fmt.Errorf("failed to open file for appending: %w", err)
-					}
+	tickers, err := parseTickers(*tickersFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if *tickersFile != "" {
+		fileTickers, err := readTickersFile(*tickersFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		tickers = append(tickers, fileTickers...)
+	}
 
-					for _, ohlc := range data {
-						line := fmt.Sprintf("%s,%s,%g,%g,%g,%g,%d\n",
-							ohlc.Date.Format("20060102"),
-							ohlc.Date.Format("15:04:05"),
-							ohlc.Open, ohlc.High, ohlc.Low, ohlc.Close, ohlc.Volume)
-						if _, err := file.WriteString(line); err != nil {
-							file.Close()
-							return fmt.Errorf("failed to write to file: %w", err)
-						}
-					}
-					file.Close()
-				}
-			}
-			return nil
-		})
+	job := history.JobSpec{
+		Kind:     *kind,
+		Engine:   *engine,
+		Market:   *market,
+		Board:    *board,
+		Tickers:  tickers,
+		FromYear: *fromYear,
+		ToYear:   *toYear,
+		Interval: *interval,
+	}
+	if len(job.Tickers) == 0 && *config == "" {
+		if job.JobKind() != history.JobFutures {
+			fmt.Fprintln(os.Stderr, "Error: -tickers are required for shares")
+			os.Exit(2)
+		}
+		job.Tickers = futures
+	}
 
+	// Cancel running downloads on Ctrl-C, incomplete files are discarded
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := history.ProcessOptions{
+		OutputDir:          *out,
+		Writer:             history.DefaultWriter(),
+		Concurrency:        *concurrency,
+		LogLevel:           logLevel,
+		YearDigits:         2,
+		MaxRuntime:         *maxRuntime,
+		WriteSummary:       *summary,
+		DryRun:             *dryRun,
+		WriteChecksum:      *checksum,
+		ClampToFirstCandle: *clampFirstCandle,
+	}
+	opts.Writer.Contract = *contract
+	if logLevel >= history.LogInfo {
+		opts.Progress = history.PrintProgress
 	}
 
-	return gr.Wait()
-}
+	jobs := []history.JobSpec{job}
+	if *config != "" {
+		load := history.LoadJobs
+		if strings.HasSuffix(strings.ToLower(*config), ".csv") {
+			load = history.LoadWatchlistCSV
+		}
+		if jobs, err = load(*config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
 
-func main() {
-	futures := []string{
-		"Si", "BR", "RI", "SR", "GZ", "LK", "MX", "GD", "RN", "VB", "MG", "SN", "NL", "MT", "GM", "TT", "PL", "CH", "YN", "AL", "ME", "FV", "PO", "PH", "TN", "AF", "NV", "PK", "RU", "HY",
+	fetcher := &history.Fetcher{LogLevel: logLevel}
+	if *cacheDir != "" {
+		fetcher.Client = &http.Client{Transport: &history.DiskCache{Dir: *cacheDir, Refresh: *refreshCache}}
 	}
-	if err := ProcessContracts(2016, 2026, futures...); err != nil {
-		// if err := ProcessContracts(2016, 2026, "Si", "VB", "RI", "LK", "SR", "GZ"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if *maxClockSkew > 0 && !*dryRun {
+		if _, err := fetcher.CheckClockSkew(ctx, *maxClockSkew); err != nil && logLevel >= history.LogInfo {
+			fmt.Fprintf(os.Stderr, "Warning: failed to check clock skew: %v\n", err)
+		}
+	}
+	for _, job := range jobs {
+		report, err := history.RunJob(ctx, fetcher, opts, job)
+		if report != nil && logLevel >= history.LogInfo {
+			fmt.Println(report.Summary())
+			if tickers := report.UnderCovered(); len(tickers) > 0 {
+				fmt.Printf("Under-covered tickers: %s\n", strings.Join(tickers, ", "))
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			stop()
+			os.Exit(1)
+		}
 	}
 }
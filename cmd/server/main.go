@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/denis-gudim/moex-history-downloader/internal/history"
+	"github.com/denis-gudim/moex-history-downloader/internal/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	flag.Parse()
+
+	handler := server.NewHandler(&history.Fetcher{})
+	fmt.Printf("Serving candles on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
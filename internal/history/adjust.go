@@ -0,0 +1,33 @@
+package history
+
+import (
+	"context"
+	"time"
+)
+
+// Adjustment is a corporate action changing price scale of a share, like
+// a split or a dividend. Prices before Date are multiplied by Factor to be
+// comparable with later ones, e.g. 0.1 for 1:10 split or 1 - dividend/close
+// of the day before the ex-dividend date.
+type Adjustment struct {
+	Date   time.Time
+	Factor float64
+}
+
+// AdjustFunc returns corporate actions of ticker, it is the hook supplying
+// adjustment factors from an external source
+type AdjustFunc func(ctx context.Context, ticker string) ([]Adjustment, error)
+
+// Adjust sets AdjClose of candles to Close multiplied by factors of all
+// adjustments dated after the candle, so the latest prices stay raw
+func Adjust(data []OHLCV, adjustments []Adjustment) {
+	for i := range data {
+		factor := 1.0
+		for _, adjustment := range adjustments {
+			if data[i].Date.Before(adjustment.Date) {
+				factor *= adjustment.Factor
+			}
+		}
+		data[i].AdjClose = data[i].Close * factor
+	}
+}
@@ -0,0 +1,84 @@
+package history
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdjust(t *testing.T) {
+	adjustments := []Adjustment{
+		{Date: moscowTime(2024, 7, 15, 0, 0), Factor: 0.1},  // 1:10 split
+		{Date: moscowTime(2024, 7, 20, 0, 0), Factor: 0.95}, // dividend of 5% of the close
+	}
+	tests := []struct {
+		date time.Time
+		want float64
+	}{
+		{moscowTime(2024, 7, 10, 10, 0), 1000 * 0.1 * 0.95},
+		{moscowTime(2024, 7, 14, 23, 59), 1000 * 0.1 * 0.95},
+		// Candles on the action date are already traded at the new scale
+		{moscowTime(2024, 7, 15, 0, 0), 1000 * 0.95},
+		{moscowTime(2024, 7, 19, 18, 0), 1000 * 0.95},
+		{moscowTime(2024, 7, 20, 10, 0), 1000},
+		{moscowTime(2024, 7, 21, 10, 0), 1000},
+	}
+
+	data := make([]OHLCV, len(tests))
+	for i, test := range tests {
+		data[i] = OHLCV{Date: test.date, Close: 1000}
+	}
+	Adjust(data, adjustments)
+
+	for i, test := range tests {
+		if math.Abs(data[i].AdjClose-test.want) > 1e-9 {
+			t.Errorf("%s: got adjusted close %v, want %v", test.date, data[i].AdjClose, test.want)
+		}
+		if data[i].Close != 1000 {
+			t.Errorf("%s: raw close changed to %v", test.date, data[i].Close)
+		}
+	}
+
+	none := []OHLCV{{Date: tests[0].date, Close: 1000}}
+	if Adjust(none, nil); none[0].AdjClose != 1000 {
+		t.Errorf("got adjusted close %v without adjustments, want raw close", none[0].AdjClose)
+	}
+}
+
+func TestAdjustmentsRefreshWholeFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "SBER.txt")
+	// Written before the split was announced
+	existing := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>,<ADJ_CLOSE>\n" +
+		"20230301,10:00:00,100,101,99,100.5,10,100.5\n20230301,10:01:00,101,102,100,101.5,11,101.5\n"
+	if err := os.WriteFile(fileName, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 3)))
+	writer := DefaultWriter()
+	writer.AdjClose = true
+	opts := ProcessOptions{
+		OutputDir: dir, Writer: writer, Interval: IntervalMinute1, RequestDelay: -1, Incremental: true,
+		Adjustments: func(ctx context.Context, ticker string) ([]Adjustment, error) {
+			return []Adjustment{{Date: moscowTime(2023, 3, 1, 10, 2), Factor: 0.5}}, nil
+		},
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>,<ADJ_CLOSE>",
+		"20230301,10:00:00,100,101,99,100.5,10,50.25",
+		"20230301,10:01:00,101,102,100,101.5,11,50.75",
+		"20230301,10:02:00,102,103,101,102.5,12,102.5",
+	}
+	if got := readLines(t, fileName); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
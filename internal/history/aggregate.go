@@ -0,0 +1,45 @@
+package history
+
+import (
+	"math"
+	"time"
+)
+
+// SummaryOHLC aggregates candles dated from from till till inclusive, like ISS
+// from/till parameters, into a single bar: open of the first candle, close of
+// the last one, max high, min low and summed volume and value. Candles must be
+// sorted by Date, false is returned when the range has no candles. Volume
+// saturates at math.MaxInt64 instead of wrapping.
+func SummaryOHLC(candles []OHLCV, from, till time.Time) (OHLCV, bool) {
+	var summary OHLCV
+	var found bool
+
+	for _, ohlc := range candles {
+		if ohlc.Date.Before(from) || ohlc.Date.After(till) {
+			continue
+		}
+
+		if !found {
+			summary = ohlc
+			found = true
+			continue
+		}
+
+		if ohlc.High > summary.High {
+			summary.High = ohlc.High
+		}
+		if ohlc.Low < summary.Low {
+			summary.Low = ohlc.Low
+		}
+		volume, err := addVolume(summary.Volume, ohlc.Volume)
+		if err != nil {
+			volume = math.MaxInt64
+		}
+		summary.Close = ohlc.Close
+		summary.End = ohlc.End
+		summary.Volume = volume
+		summary.Value += ohlc.Value
+	}
+
+	return summary, found
+}
@@ -0,0 +1,50 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummaryOHLCSubset(t *testing.T) {
+	begin := moscowTime(2024, 1, 10, 10, 0)
+	data := minuteCandles("SBER", begin, 5)
+	data[2].High = 200
+	data[3].Low = 50
+
+	got, ok := SummaryOHLC(data, data[1].Date, data[3].Date)
+	if !ok {
+		t.Fatal("got no summary of non empty range")
+	}
+
+	want := OHLCV{Ticker: "SBER", Date: data[1].Date, Open: 101, High: 200, Low: 50, Close: 103.5, Volume: 11 + 12 + 13}
+	if got.Ticker != want.Ticker || !got.Date.Equal(want.Date) || got.Open != want.Open || got.High != want.High ||
+		got.Low != want.Low || got.Close != want.Close || got.Volume != want.Volume {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSummaryOHLCEmptyRange(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 5)
+
+	from := moscowTime(2024, 1, 11, 10, 0)
+	if _, ok := SummaryOHLC(data, from, from.Add(time.Hour)); ok {
+		t.Error("got summary of empty range")
+	}
+	if _, ok := SummaryOHLC(nil, data[0].Date, data[4].Date); ok {
+		t.Error("got summary of no candles")
+	}
+}
+
+func TestSummaryOHLCVolumeSaturates(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3)
+	data[0].Volume = math.MaxInt64 - 20
+	data[1].Volume = 10
+
+	if got, _ := SummaryOHLC(data, data[0].Date, data[1].Date); got.Volume != math.MaxInt64-10 {
+		t.Errorf("got volume %d, want %d", got.Volume, int64(math.MaxInt64-10))
+	}
+	if got, _ := SummaryOHLC(data, data[0].Date, data[2].Date); got.Volume != math.MaxInt64 {
+		t.Errorf("got volume %d, want saturated %d", got.Volume, int64(math.MaxInt64))
+	}
+}
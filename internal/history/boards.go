@@ -0,0 +1,148 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// boardChains are boards tried in order for instruments of engine/market
+// when board is not specified
+var boardChains = struct {
+	mu     sync.RWMutex
+	chains map[string][]string
+}{
+	chains: map[string][]string{
+		SharesEngine + "/" + SharesMarket:     {SharesBoard, "SMAL"},
+		CurrencyEngine + "/" + CurrencyMarket: {CurrencyBoard},
+		FuturesEngine + "/" + FuturesMarket:   {FuturesBoard},
+	},
+}
+
+// RegisterBoards sets boards Fetch tries in order for engine market
+// instruments requested without board, replacing the default chain
+func RegisterBoards(engine, market string, boards ...string) {
+	boardChains.mu.Lock()
+	defer boardChains.mu.Unlock()
+	boardChains.chains[engine+"/"+market] = append([]string(nil), boards...)
+}
+
+// BoardChain returns boards tried in order for engine market instruments
+// requested without board, e.g. TQBR and SMAL for stock shares
+func BoardChain(engine, market string) []string {
+	boardChains.mu.RLock()
+	defer boardChains.mu.RUnlock()
+	return append([]string(nil), boardChains.chains[engine+"/"+market]...)
+}
+
+// fetchBoardChain fetches candles from the first board of engine market chain
+// having any candles of ticker in the date range
+func (f *Fetcher) fetchBoardChain(
+	ctx context.Context, engine, market, ticker string, startDate, endDate time.Time, interval int,
+) ([]OHLCV, error) {
+	boards := BoardChain(engine, market)
+	if len(boards) == 0 {
+		return nil, errors.Errorf("no boards registered for %s/%s", engine, market)
+	}
+
+	for _, board := range boards {
+		data, err := f.Fetch(ctx, engine, market, board, ticker, startDate, endDate, interval)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			return data, nil
+		}
+	}
+	return nil, nil
+}
+
+// FetchAcrossBoards fetches candles of the same ticker on several boards
+// concurrently, e.g. TQBR and SMAL, and returns them keyed by board.
+// Boards without candles in the date range are returned with empty series.
+func (f *Fetcher) FetchAcrossBoards(
+	ctx context.Context, engine, market string, boards []string, ticker string,
+	startDate, endDate time.Time, interval int,
+) (map[string][]OHLCV, error) {
+	var mu sync.Mutex
+	result := make(map[string][]OHLCV, len(boards))
+
+	gr, ctx := errgroup.WithContext(ctx)
+	gr.SetLimit(DefaultConcurrency)
+
+	for _, board := range boards {
+		gr.Go(func() error {
+			data, err := f.Fetch(ctx, engine, market, board, ticker, startDate, endDate, interval)
+			if err != nil {
+				return errors.Wrapf(err, "fetch %s on board %s", ticker, board)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result[board] = data
+			return nil
+		})
+	}
+
+	if err := gr.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Board is a trading board of a market
+type Board struct {
+	BoardID string
+	Title   string
+	// IsPrimary marks the primary board of a security, it is set by
+	// ListSecurityBoards only since market boards have no primary one
+	IsPrimary bool
+}
+
+// ListBoards returns trading boards of engine market, e.g. TQBR and SMAL
+// of stock shares market
+func (f *Fetcher) ListBoards(ctx context.Context, engine, market string) ([]Board, error) {
+	url := fmt.Sprintf("%s/engines/%s/markets/%s/boards.json?iss.meta=off&iss.only=boards", issURL, engine, market)
+
+	tables, err := f.getTables(ctx, "", url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list boards of %s/%s", engine, market)
+	}
+
+	var boards []Board
+	for _, row := range tables["boards"].rows() {
+		boards = append(boards, Board{
+			BoardID: cellString(row["boardid"]),
+			Title:   cellString(row["title"]),
+		})
+	}
+	return boards, nil
+}
+
+// ListSecurityBoards returns boards of engine market ticker is traded on
+// with its primary board marked, e.g. TQBR for SBER
+func (f *Fetcher) ListSecurityBoards(ctx context.Context, engine, market, ticker string) ([]Board, error) {
+	url := fmt.Sprintf("%s/securities/%s.json?iss.meta=off&iss.only=boards", issURL, ticker)
+
+	tables, err := f.getTables(ctx, ticker, url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list boards of %s", ticker)
+	}
+
+	var boards []Board
+	for _, row := range tables["boards"].rows() {
+		if cellString(row["engine"]) != engine || cellString(row["market"]) != market {
+			continue
+		}
+		boards = append(boards, Board{
+			BoardID:   cellString(row["boardid"]),
+			Title:     cellString(row["title"]),
+			IsPrimary: cellInt(row["is_primary"]) == 1,
+		})
+	}
+	return boards, nil
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveBoards answers candles requests with candles of the requested board
+func serveBoards(boards map[string][]OHLCV) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for board, data := range boards {
+			if strings.Contains(r.URL.Path, "/boards/"+board+"/") {
+				servePages(data)(w, r)
+				return
+			}
+		}
+		servePages(nil)(w, r)
+	}
+}
+
+func TestFetchAcrossBoards(t *testing.T) {
+	begin := moscowTime(2024, 1, 10, 10, 0)
+	fetcher := newTestFetcher(serveBoards(map[string][]OHLCV{
+		"TQBR": minuteCandles("SBER", begin, 3),
+		"SMAL": minuteCandles("SBER", begin, 1),
+	}))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.FetchAcrossBoards(context.Background(), SharesEngine, SharesMarket,
+		[]string{"TQBR", "SMAL", "TQTF"}, "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for board, want := range map[string]int{"TQBR": 3, "SMAL": 1, "TQTF": 0} {
+		data, ok := got[board]
+		if !ok {
+			t.Errorf("%s isn't returned", board)
+		}
+		if len(data) != want {
+			t.Errorf("%s: got %d candles, want %d", board, len(data), want)
+		}
+	}
+}
+
+func TestEmptySharesBoardResolvesToTQBR(t *testing.T) {
+	begin := moscowTime(2024, 1, 10, 10, 0)
+	var boards []string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		boards = append(boards, strings.Split(r.URL.Path, "/")[7])
+		serveBoards(map[string][]OHLCV{"TQBR": minuteCandles("SBER", begin, 2)})(w, r)
+	})
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), SharesEngine, SharesMarket, "", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Errorf("got %d candles, want 2 of TQBR", len(got))
+	}
+	if len(boards) != 1 || boards[0] != "TQBR" {
+		t.Errorf("requested boards %v, want [TQBR]", boards)
+	}
+	if chain := BoardChain(SharesEngine, SharesMarket); len(chain) == 0 || chain[0] != "TQBR" {
+		t.Errorf("got shares chain %v", chain)
+	}
+}
+
+func TestBoardChainFallback(t *testing.T) {
+	fetcher := newTestFetcher(serveBoards(map[string][]OHLCV{
+		"SMAL": minuteCandles("ILLQ", moscowTime(2024, 1, 10, 10, 0), 1),
+	}))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), SharesEngine, SharesMarket, "", "ILLQ", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("got %d candles, want 1 of SMAL", len(got))
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), "stock", "bonds", "", "SU26238RMFS4", day, day, IntervalMinute1); err == nil {
+		t.Error("expected error of market without boards")
+	}
+}
+
+func TestListSecurityBoards(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/iss/securities/SBER.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"boards": {"columns": ["secid", "boardid", "title", "market", "engine", "is_primary"], "data": [
+			["SBER", "TQBR", "Т+: Акции и ДР - безадрес.", "shares", "stock", 1],
+			["SBER", "SMAL", "Т+: Неполные лоты (акции) - безадрес.", "shares", "stock", 0],
+			["SBER", "SPEQ", "Поставка по СК (акции)", "shares", "stock", 0],
+			["SBER", "RPMO", "РЕПО с ЦК - безадрес.", "repo", "stock", 0]
+		]}}`)
+	})
+
+	boards, err := fetcher.ListSecurityBoards(context.Background(), SharesEngine, SharesMarket, "SBER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boards) != 3 {
+		t.Fatalf("got %d boards, want 3 of shares market: %v", len(boards), boards)
+	}
+	for _, board := range boards {
+		if board.IsPrimary != (board.BoardID == "TQBR") {
+			t.Errorf("%s: got primary %v", board.BoardID, board.IsPrimary)
+		}
+	}
+}
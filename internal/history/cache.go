@@ -0,0 +1,76 @@
+package history
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache keeps fetched candles by request key, see Fetcher.Cache
+type Cache interface {
+	// Get returns candles stored for key, false when they are missing or expired
+	Get(key string) ([]OHLCV, bool)
+	// Set stores candles for key
+	Set(key string, data []OHLCV)
+}
+
+// cacheKey returns cache key of candles request including Fetcher options
+// changing the result, so fetchers configured differently don't share entries
+func (f *Fetcher) cacheKey(engine, market, board, ticker string, startDate, endDate time.Time, interval int) string {
+	key := fmt.Sprintf("%s/%s/%s/%s/%s/%s/%d", engine, market, board, ticker,
+		issTime(startDate, time.UTC), issTime(endDate, time.UTC), interval)
+
+	// Current session is excluded only until the next one starts
+	var session string
+	if f.WholeSessionsOnly {
+		session = sessionStart(time.Now(), f.location()).Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s?limit=%d&whole_sessions=%s&close=%s&utc=%t&sort=%s/%s", key,
+		f.Limit, session, f.closeColumn(), f.ParseUTC, f.SortColumn, f.SortOrder)
+}
+
+// MemoryCache is a map backed Cache keeping entries for TTL,
+// zero TTL keeps them forever. It is safe for concurrent use.
+type MemoryCache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	data    []OHLCV
+	expires time.Time
+}
+
+// Get returns candles stored for key unless they are expired
+func (c *MemoryCache) Get(key string) ([]OHLCV, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// Set stores candles for key
+func (c *MemoryCache) Set(key string, data []OHLCV) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+
+	var expires time.Time
+	if c.TTL > 0 {
+		expires = time.Now().Add(c.TTL)
+	}
+	c.entries[key] = cacheEntry{data: data, expires: expires}
+}
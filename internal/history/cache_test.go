@@ -0,0 +1,66 @@
+package history
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheServesIdenticalRequests(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 10)
+	var requests atomic.Int32
+	fetcher := newTestFetcher(countRequests(&requests, servePages(data)))
+	fetcher.Cache = &MemoryCache{}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	fetch := func() []OHLCV {
+		t.Helper()
+		got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	fetch()
+	fetch()
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("made %d requests of identical fetches, want 1", n)
+	}
+
+	// Cached result of other Limit isn't returned
+	fetcher.Limit = 3
+	if got := fetch(); len(got) != 3 {
+		t.Errorf("got %d candles with Limit 3", len(got))
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("made %d requests, want 2", n)
+	}
+}
+
+func TestCacheKeyIncludesOptions(t *testing.T) {
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	key := func(f *Fetcher) string {
+		return f.cacheKey("stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	}
+	base := key(&Fetcher{})
+
+	for name, fetcher := range map[string]*Fetcher{
+		"Limit":             {Limit: 3},
+		"WholeSessionsOnly": {WholeSessionsOnly: true},
+		"CloseColumn":       {CloseColumn: "legalcloseprice"},
+		"ParseUTC":          {ParseUTC: true},
+		"SortColumn":        {SortColumn: "begin"},
+		"SortOrder":         {SortOrder: "desc"},
+	} {
+		if key(fetcher) == base {
+			t.Errorf("%s doesn't change cache key", name)
+		}
+	}
+
+	// Explicit default close column gives the same result
+	if key(&Fetcher{CloseColumn: "close"}) != base {
+		t.Error("default close column changes cache key")
+	}
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CalendarTickers map boards to liquid securities traded every trading day,
+// their daily candles are used by InferTradingDates as trading dates of the
+// board. Boards without a long living security, like futures boards, have
+// to be added by caller.
+var CalendarTickers = map[string]string{
+	SharesBoard:   "SBER",
+	CurrencyBoard: "USD000UTSTOM",
+}
+
+// InferTradingDates returns dates the board traded on from the date range in
+// ascending order. It is a heuristic rather than the exchange calendar: dates
+// are inferred from daily candles of the board security in CalendarTickers,
+// so a session without trades in that security or its suspension is missing
+// from the result the same way as weekends and exchange holidays are.
+func (f *Fetcher) InferTradingDates(
+	ctx context.Context, engine, market, board string, from, till time.Time,
+) ([]time.Time, error) {
+	ticker, ok := CalendarTickers[board]
+	if !ok {
+		return nil, errors.Errorf("no calendar ticker for board %s", board)
+	}
+
+	var dates []time.Time
+	err := f.FetchStream(ctx, engine, market, board, ticker, from, till, IntervalDay, func(ohlc OHLCV) error {
+		date := sessionStart(ohlc.Date, ohlc.Date.Location())
+		if n := len(dates); n == 0 || !dates[n-1].Equal(date) {
+			dates = append(dates, date)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch trading dates of %s", board)
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	return dates, nil
+}
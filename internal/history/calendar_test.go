@@ -0,0 +1,42 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInferTradingDates(t *testing.T) {
+	var days []OHLCV
+	for _, day := range []int{9, 10, 12} {
+		days = append(days, minuteCandles("SBER", moscowTime(2024, 1, day, 0, 0), 1)...)
+	}
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/securities/SBER/") {
+			http.NotFound(w, r)
+			return
+		}
+		servePages(days)(w, r)
+	})
+
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	till := time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)
+	dates, err := fetcher.InferTradingDates(context.Background(), SharesEngine, SharesMarket, SharesBoard, from, till)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, date := range dates {
+		got = append(got, date.Format("2006-01-02"))
+	}
+	if want := "2024-01-09,2024-01-10,2024-01-12"; strings.Join(got, ",") != want {
+		t.Errorf("got dates %v, want %s", got, want)
+	}
+
+	if _, err := fetcher.InferTradingDates(context.Background(), FuturesEngine, FuturesMarket, FuturesBoard, from, till); err == nil {
+		t.Error("no error for board without calendar ticker")
+	}
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrCorruptFile is returned by Verify for files not matching their checksum sidecar
+var ErrCorruptFile = errors.New("file doesn't match its checksum")
+
+// checksumPath returns checksum sidecar path of output file
+func checksumPath(fileName string) string {
+	return fileName + ".sha256"
+}
+
+// fileDigest returns hex SHA-256 of file content and its candles rows count,
+// rows of compressed files are counted in decompressed content
+func fileDigest(fileName string, w Writer) (string, int, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	var content io.Reader = io.TeeReader(file, hash)
+	if strings.HasSuffix(fileName, ".gz") {
+		gz, err := gzip.NewReader(content)
+		if err != nil {
+			return "", 0, err
+		}
+		defer gz.Close()
+		content = gz
+	}
+
+	var lines int
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := content.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	// Drain bytes after the compressed stream, e.g. of a truncated member
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", 0, err
+	}
+
+	rows := lines
+	if w.WriteHeader && rows > 0 {
+		rows--
+	}
+	return hex.EncodeToString(hash.Sum(nil)), rows, nil
+}
+
+// writeChecksum writes <name>.sha256 sidecar of output file in sha256sum
+// format followed by "# rows <count>" line
+func writeChecksum(fileName string, w Writer) error {
+	sum, rows, err := fileDigest(fileName, w)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum: %w", err)
+	}
+
+	content := fmt.Sprintf("%s  %s\n# rows %d\n", sum, filepath.Base(fileName), rows)
+	if err := os.WriteFile(checksumPath(fileName), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum: %w", err)
+	}
+	return nil
+}
+
+// Verify checks candles file written with w layout against its .sha256
+// sidecar written with WriteChecksum, ErrCorruptFile is returned when
+// content or rows count differ, e.g. for a truncated file
+func Verify(fileName string, w Writer) error {
+	content, err := os.ReadFile(checksumPath(fileName))
+	if err != nil {
+		return fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	var expectedSum string
+	expectedRows := -1
+	for _, line := range strings.Split(string(content), "\n") {
+		if count, ok := strings.CutPrefix(line, "# rows "); ok {
+			if expectedRows, err = strconv.Atoi(count); err != nil {
+				return fmt.Errorf("failed to parse checksum rows: %w", err)
+			}
+		} else if fields := strings.Fields(line); len(fields) > 0 && expectedSum == "" {
+			expectedSum = fields[0]
+		}
+	}
+	if expectedSum == "" {
+		return fmt.Errorf("missing checksum of %s", fileName)
+	}
+
+	sum, rows, err := fileDigest(fileName, w)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) {
+		return fmt.Errorf("%s is damaged, %v: %w", fileName, err, ErrCorruptFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	if expectedRows >= 0 && rows != expectedRows {
+		return fmt.Errorf("%s has %d rows, expected %d: %w", fileName, rows, expectedRows, ErrCorruptFile)
+	}
+	if sum != expectedSum {
+		return fmt.Errorf("%s checksum %s, expected %s: %w", fileName, sum, expectedSum, ErrCorruptFile)
+	}
+	return nil
+}
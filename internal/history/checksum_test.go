@@ -0,0 +1,118 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeChecksummed downloads SBER with checksum sidecar and returns file name
+func writeChecksummed(t *testing.T, gz bool) (string, ProcessOptions) {
+	t.Helper()
+	dir := t.TempDir()
+	fetcher := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 20)))
+	opts := ProcessOptions{
+		OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1,
+		WriteChecksum: true, Gzip: gz,
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+
+	fileName := filepath.Join(dir, "SBER.txt")
+	if gz {
+		fileName += ".gz"
+	}
+	return fileName, opts
+}
+
+func TestVerify(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		fileName, opts := writeChecksummed(t, gz)
+		if err := Verify(fileName, opts.Writer); err != nil {
+			t.Errorf("gzip %t: %v", gz, err)
+		}
+
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, content[:len(content)-10], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(fileName, opts.Writer); !errors.Is(err, ErrCorruptFile) {
+			t.Errorf("gzip %t: got %v for truncated file, want %v", gz, err, ErrCorruptFile)
+		}
+	}
+}
+
+func TestVerifyChangedByte(t *testing.T) {
+	fileName, opts := writeChecksummed(t, false)
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Row count stays the same, only the digest tells
+	content[len(content)/2] ^= 1
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(fileName, opts.Writer); !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("got %v, want %v", err, ErrCorruptFile)
+	}
+}
+
+func TestVerifyRowsMismatch(t *testing.T) {
+	fileName, opts := writeChecksummed(t, false)
+	sidecar, err := os.ReadFile(checksumPath(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("# rows 20\n")
+	if string(sidecar[len(sidecar)-len(want):]) != string(want) {
+		t.Fatalf("got sidecar %q, want 20 rows", sidecar)
+	}
+
+	// Digest matches, rows count doesn't
+	sidecar = append(sidecar[:len(sidecar)-len(want)], "# rows 21\n"...)
+	if err := os.WriteFile(checksumPath(fileName), sidecar, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(fileName, opts.Writer); !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("got %v, want %v", err, ErrCorruptFile)
+	}
+}
+
+func TestVerifyMissingSidecar(t *testing.T) {
+	fileName, opts := writeChecksummed(t, false)
+	if err := os.Remove(checksumPath(fileName)); err != nil {
+		t.Fatal(err)
+	}
+	err := Verify(fileName, opts.Writer)
+	if err == nil || errors.Is(err, ErrCorruptFile) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want missing sidecar error", err)
+	}
+}
+
+func TestAppendRefusesCorruptFile(t *testing.T) {
+	fileName, opts := writeChecksummed(t, false)
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 1
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Incremental = true
+	fetcher := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 2, 10, 0), 1)))
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("got %v, want %v", err, ErrCorruptFile)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != string(content) {
+		t.Error("corrupt file was appended to")
+	}
+}
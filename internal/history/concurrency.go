@@ -0,0 +1,18 @@
+package history
+
+// DefaultConcurrency is the recommended number of instruments processed in parallel
+const DefaultConcurrency = 4
+
+// NormalizeConcurrency returns limit suitable for errgroup.SetLimit. Zero
+// means DefaultConcurrency and negative values are normalized to 1, so
+// misconfigured concurrency downloads sequentially instead of being unlimited
+// or blocking forever.
+func NormalizeConcurrency(n int) int {
+	switch {
+	case n == 0:
+		return DefaultConcurrency
+	case n < 0:
+		return 1
+	}
+	return n
+}
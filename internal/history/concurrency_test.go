@@ -0,0 +1,72 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxInFlight processes tickers with concurrency and returns the maximum
+// number of ISS requests served at the same time
+func maxInFlight(t *testing.T, concurrency int) int {
+	t.Helper()
+	var mu sync.Mutex
+	var inFlight, max int
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, candlesCSV(candlesHeader))
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+
+	opts := ProcessOptions{
+		OutputDir:    t.TempDir(),
+		Writer:       DefaultWriter(),
+		Interval:     IntervalMinute1,
+		Concurrency:  concurrency,
+		RequestDelay: -1,
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER", "GAZP", "LKOH"); err != nil {
+		t.Fatal(err)
+	}
+	return max
+}
+
+func TestZeroConcurrencyIsDefault(t *testing.T) {
+	// DefaultConcurrency exceeds the number of tickers
+	if got := maxInFlight(t, 0); got != 3 {
+		t.Errorf("zero concurrency made %d requests at once, want 3", got)
+	}
+}
+
+func TestNegativeConcurrencyIsSequential(t *testing.T) {
+	if got := maxInFlight(t, -1); got != 1 {
+		t.Errorf("negative concurrency made %d requests at once, want 1", got)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	if got := maxInFlight(t, 2); got != 2 {
+		t.Errorf("concurrency 2 made %d requests at once", got)
+	}
+}
+
+func TestNormalizeConcurrency(t *testing.T) {
+	for n, want := range map[int]int{-3: 1, 0: DefaultConcurrency, 1: 1, 8: 8} {
+		if got := NormalizeConcurrency(n); got != want {
+			t.Errorf("NormalizeConcurrency(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// coverage collects gaps of instrument candles written chunk by chunk
+type coverage struct {
+	interval int
+	first    time.Time
+	last     *OHLCV
+	gaps     []Gap
+}
+
+// add detects gaps in sorted data chunk including the boundary with the previous one
+func (c *coverage) add(data []OHLCV) {
+	if len(data) == 0 {
+		return
+	}
+	if c.first.IsZero() {
+		c.first = data[0].Date
+	}
+	if c.last != nil {
+		if gap, ok := findGap(c.last.Date, data[0].Date, c.interval, weekday); ok {
+			c.gaps = append(c.gaps, gap)
+		}
+	}
+	c.gaps = append(c.gaps, FindGaps(data, c.interval)...)
+	c.last = &data[len(data)-1]
+}
+
+// report records covered dates range and gaps into instrument result
+func (c *coverage) report(result *TickerResult) {
+	if c.last == nil {
+		return
+	}
+	if result.First.IsZero() {
+		result.First = c.first
+	}
+	result.Last = c.last.Date
+	result.Gaps = append(result.Gaps, c.gaps...)
+}
+
+// coveragePath returns companion coverage file path of output file
+func coveragePath(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".coverage.csv"
+}
+
+// write writes gaps into companion coverage file of output file
+func (c *coverage) write(fileName string, w Writer) error {
+	file, err := os.Create(coveragePath(fileName))
+	if err != nil {
+		return fmt.Errorf("failed to create coverage file: %w", err)
+	}
+	defer file.Close()
+
+	layout := w.dateFormat() + " " + w.timeFormat()
+	if _, err := file.WriteString("start,end,missing\n"); err != nil {
+		return fmt.Errorf("failed to write coverage file: %w", err)
+	}
+	for _, gap := range c.gaps {
+		line := fmt.Sprintf("%s,%s,%d\n", gap.Start.Format(layout), gap.End.Format(layout), gap.Missing)
+		if _, err := file.WriteString(line); err != nil {
+			return fmt.Errorf("failed to write coverage file: %w", err)
+		}
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,44 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoverageFileListsGap(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 6)
+	// Inject a gap of three bars from 10:02 till 10:04
+	data = append(data[:2], data[5:]...)
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Query().Get("from"), "2023-03") {
+			servePages(data)(w, r)
+			return
+		}
+		servePages(nil)(w, r)
+	})
+
+	dir := t.TempDir()
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, WriteCoverage: true}
+	report, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"start,end,missing",
+		"20230301 10:02:00,20230301 10:04:00,3",
+	}
+	got := readLines(t, filepath.Join(dir, "SBER.coverage.csv"))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	gaps := report.Results[0].Gaps
+	if len(gaps) != 1 || !gaps[0].Start.Equal(moscowTime(2023, 3, 1, 10, 2)) || gaps[0].End.Sub(gaps[0].Start) != 2*time.Minute {
+		t.Errorf("got report gaps %v", gaps)
+	}
+}
@@ -0,0 +1,24 @@
+package history
+
+import (
+	"context"
+	"time"
+)
+
+// Currency market coordinates on MOEX ISS. Spot FX instruments such as
+// USD000UTSTOM (USD/RUB) and EUR_RUB__TOM (EUR/RUB) are traded on the
+// "selt" market of the "currency" engine, main board "CETS".
+const (
+	CurrencyEngine = "currency"
+	CurrencyMarket = "selt"
+	CurrencyBoard  = "CETS"
+)
+
+// FetchCurrency fetches candles for a currency pair traded on the CETS board.
+// Currency quotes may carry more decimal places than shares, prices are
+// parsed as float64 so no precision handling is required from the caller.
+func (f *Fetcher) FetchCurrency(
+	ctx context.Context, ticker string, startDate, endDate time.Time, interval int,
+) ([]OHLCV, error) {
+	return f.Fetch(ctx, CurrencyEngine, CurrencyMarket, CurrencyBoard, ticker, startDate, endDate, interval)
+}
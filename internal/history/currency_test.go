@@ -0,0 +1,43 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchCurrencyParsesPrecisePrices(t *testing.T) {
+	var path string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, candlesCSV(candlesHeader,
+			"92.1275;92.1325;92.14;92.12;921300000.5;10000;2024-03-01 10:00:00;2024-03-01 10:00:59",
+		))
+	})
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	data, err := fetcher.FetchCurrency(context.Background(), "USD000UTSTOM", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/engines/currency/markets/selt/boards/CETS/securities/USD000UTSTOM/candles.csv"; !strings.HasSuffix(path, want) {
+		t.Errorf("requested %s, want %s", path, want)
+	}
+	if len(data) != 1 {
+		t.Fatalf("got %d candles, want 1", len(data))
+	}
+	got := data[0]
+	if got.Open != 92.1275 || got.Close != 92.1325 || got.High != 92.14 || got.Low != 92.12 {
+		t.Errorf("got prices %v %v %v %v", got.Open, got.High, got.Low, got.Close)
+	}
+	if got.Volume != 10000 || got.Ticker != "USD000UTSTOM" {
+		t.Errorf("got volume %d ticker %s", got.Volume, got.Ticker)
+	}
+	if row := got.String(); row != "20240301,10:00:00,92.1275,92.14,92.12,92.1325,10000" {
+		t.Errorf("got row %s", row)
+	}
+}
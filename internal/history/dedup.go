@@ -0,0 +1,54 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Dedup returns candles sorted by Date with duplicate timestamps removed.
+// The latest candle among duplicates wins as the most recently fetched one.
+func Dedup(data []OHLCV) []OHLCV {
+	if len(data) == 0 {
+		return data
+	}
+
+	sorted := make([]OHLCV, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	result := sorted[:1]
+	for _, ohlc := range sorted[1:] {
+		if ohlc.Date.Equal(result[len(result)-1].Date) {
+			result[len(result)-1] = ohlc
+			continue
+		}
+		result = append(result, ohlc)
+	}
+	return result
+}
+
+// FilterVolume returns candles traded at least min volume, all candles
+// when min is not positive. Data is filtered in place.
+func FilterVolume(data []OHLCV, min int64) []OHLCV {
+	if min <= 0 {
+		return data
+	}
+
+	result := data[:0]
+	for _, ohlc := range data {
+		if ohlc.Volume >= min {
+			result = append(result, ohlc)
+		}
+	}
+	return result
+}
+
+// After returns candles dated strictly after t, data must be sorted by Date
+func After(data []OHLCV, t time.Time) []OHLCV {
+	indx := sort.Search(len(data), func(i int) bool {
+		return data[i].Date.After(t)
+	})
+	return data[indx:]
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+// dates returns Date of every candle
+func dates(data []OHLCV) []time.Time {
+	result := make([]time.Time, len(data))
+	for i, ohlc := range data {
+		result[i] = ohlc.Date
+	}
+	return result
+}
+
+func TestDedupAdjacentWindowOverlap(t *testing.T) {
+	begin := moscowTime(2024, 3, 14, 18, 0)
+	// Second window starts two candles before the first one ends
+	first := minuteCandles("Si", begin, 5)
+	second := minuteCandles("Si", begin.Add(3*time.Minute), 4)
+	second[0].Close = 999
+
+	got := Dedup(append(append([]OHLCV(nil), first...), second...))
+
+	if len(got) != 7 {
+		t.Fatalf("got %d candles, want 7", len(got))
+	}
+	for i, date := range dates(got) {
+		if want := begin.Add(time.Duration(i) * time.Minute); !date.Equal(want) {
+			t.Errorf("candle %d at %s, want %s", i, date, want)
+		}
+	}
+	// Candle of the later window wins
+	if got[3].Close != 999 {
+		t.Errorf("got close %v of overlapping candle, want the later one", got[3].Close)
+	}
+}
+
+func TestDedupUnsortedWindows(t *testing.T) {
+	begin := moscowTime(2024, 3, 14, 18, 0)
+	later := minuteCandles("Si", begin.Add(2*time.Minute), 3)
+	earlier := minuteCandles("Si", begin, 3)
+
+	got := Dedup(append(append([]OHLCV(nil), later...), earlier...))
+
+	if len(got) != 5 {
+		t.Fatalf("got %d candles, want 5", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i-1].Date.Before(got[i].Date) {
+			t.Fatalf("candles aren't strictly ascending: %v", dates(got))
+		}
+	}
+}
+
+func TestDedupKeepsInput(t *testing.T) {
+	data := minuteCandles("Si", moscowTime(2024, 3, 14, 18, 0), 2)
+	data = append(data, data[1])
+
+	Dedup(data)
+	if len(data) != 3 || !data[2].Date.Equal(data[1].Date) {
+		t.Error("input slice was modified")
+	}
+	if got := Dedup(nil); len(got) != 0 {
+		t.Errorf("got %d candles of nil input", len(got))
+	}
+}
+
+func TestAfterSkipsWrittenCandles(t *testing.T) {
+	data := minuteCandles("Si", moscowTime(2024, 3, 14, 18, 0), 4)
+
+	got := After(data, data[1].Date)
+	if len(got) != 2 || !got[0].Date.Equal(data[2].Date) {
+		t.Errorf("got %v", dates(got))
+	}
+}
+
+func TestFilterVolume(t *testing.T) {
+	// Volumes are 10, 11, 12 and 13
+	data := minuteCandles("SBER", moscowTime(2024, 3, 14, 10, 0), 4)
+
+	if got := FilterVolume(data, 0); len(got) != 4 {
+		t.Errorf("got %d candles without minimum, want 4", len(got))
+	}
+
+	got := FilterVolume(data, 12)
+	if len(got) != 2 || got[0].Volume != 12 || got[1].Volume != 13 {
+		t.Errorf("got %d candles with volumes %v", len(got), got)
+	}
+	if got := FilterVolume(nil, 12); len(got) != 0 {
+		t.Errorf("got %d candles of nil input", len(got))
+	}
+}
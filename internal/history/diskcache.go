@@ -0,0 +1,111 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DiskCache is an http.RoundTripper keeping raw successful GET responses in
+// Dir files named by url hash, repeated requests are served from disk without
+// network. Requests with till date of today or later aren't cached, as
+// candles of the current session change. Use it as Fetcher.Client transport:
+//
+//	fetcher := &Fetcher{Client: &http.Client{Transport: &DiskCache{Dir: "iss_cache"}}}
+type DiskCache struct {
+	Dir string
+	// Transport makes requests missing in cache, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// Refresh ignores cached responses, fresh ones replace them
+	Refresh bool
+}
+
+// RoundTrip serves cached response of request url or makes the request
+// caching its successful response
+func (c *DiskCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !final(req, time.Now()) {
+		return c.transport().RoundTrip(req)
+	}
+
+	fileName := c.path(req)
+	if !c.Refresh {
+		if content, err := os.ReadFile(fileName); err == nil {
+			return http.ReadResponse(bufio.NewReader(bytes.NewReader(content)), req)
+		}
+	}
+
+	resp, err := c.transport().RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	content, err := httputil.DumpResponse(resp, true)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "dump response")
+	}
+	if err := c.store(fileName, content); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(content)), req)
+}
+
+// final reports whether response to req won't change after now, that is
+// request has no till parameter or its date is before the Moscow date of now
+func final(req *http.Request, now time.Time) bool {
+	till := req.URL.Query().Get("till")
+	if till == "" {
+		return true
+	}
+	if len(till) > len("2006-01-02") {
+		till = till[:len("2006-01-02")]
+	}
+	date, err := time.ParseInLocation("2006-01-02", till, Moscow)
+	if err != nil {
+		return false
+	}
+	return date.Before(sessionStart(now, Moscow))
+}
+
+func (c *DiskCache) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.Transport
+}
+
+// path returns cache file path of request url
+func (c *DiskCache) path(req *http.Request) string {
+	hash := sha256.Sum256([]byte(req.URL.String()))
+	return filepath.Join(c.Dir, hex.EncodeToString(hash[:])+".http")
+}
+
+// store writes response atomically so concurrent readers never see partial files
+func (c *DiskCache) store(fileName string, content []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return errors.Wrap(err, "create cache directory")
+	}
+
+	temp, err := os.CreateTemp(c.Dir, "*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create cache file")
+	}
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return errors.Wrap(err, "write cache file")
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return errors.Wrap(err, "write cache file")
+	}
+	return errors.Wrap(os.Rename(temp.Name(), fileName), "rename cache file")
+}
@@ -0,0 +1,121 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cachedFetcher returns fetcher requesting handler through DiskCache in dir
+func cachedFetcher(dir string, refresh bool, handler http.HandlerFunc) *Fetcher {
+	cache := &DiskCache{Dir: dir, Transport: handlerTransport{handler: handler}, Refresh: refresh}
+	return &Fetcher{Client: &http.Client{Transport: cache}}
+}
+
+// cacheFiles returns number of files in cache dir
+func cacheFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestDiskCacheHitAndRefresh(t *testing.T) {
+	dir := t.TempDir()
+	var requests atomic.Int32
+	volume := 10
+	handler := countRequests(&requests, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader, fmt.Sprintf("1;1;1;1;0;%d;2024-01-10 10:00:00;2024-01-10 10:00:59", volume)))
+	})
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	fetch := func(refresh bool) int64 {
+		t.Helper()
+		data, err := cachedFetcher(dir, refresh, handler).Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 1 {
+			t.Fatalf("got %d candles, want 1", len(data))
+		}
+		return data[0].Volume
+	}
+
+	// Miss stores the response, hit is served from disk
+	if got := fetch(false); got != 10 || requests.Load() != 1 || cacheFiles(t, dir) != 1 {
+		t.Fatalf("miss: got volume %d, %d requests, %d files", got, requests.Load(), cacheFiles(t, dir))
+	}
+	volume = 20
+	if got := fetch(false); got != 10 || requests.Load() != 1 {
+		t.Errorf("hit: got volume %d, %d requests", got, requests.Load())
+	}
+
+	// Refresh requests again and replaces the cached response
+	if got := fetch(true); got != 20 || requests.Load() != 2 {
+		t.Errorf("refresh: got volume %d, %d requests", got, requests.Load())
+	}
+	if got := fetch(false); got != 20 || requests.Load() != 2 || cacheFiles(t, dir) != 1 {
+		t.Errorf("after refresh: got volume %d, %d requests, %d files", got, requests.Load(), cacheFiles(t, dir))
+	}
+}
+
+func TestDiskCacheSkipsFailures(t *testing.T) {
+	dir := t.TempDir()
+	var requests atomic.Int32
+	fetcher := cachedFetcher(dir, false, countRequests(&requests, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if requests.Load() != 2 || cacheFiles(t, dir) != 0 {
+		t.Errorf("got %d requests and %d cached files, want 2 and none", requests.Load(), cacheFiles(t, dir))
+	}
+}
+
+func TestDiskCacheSkipsCurrentSession(t *testing.T) {
+	dir := t.TempDir()
+	var requests atomic.Int32
+	fetcher := cachedFetcher(dir, false, countRequests(&requests, servePages(nil)))
+
+	today := sessionStart(time.Now(), Moscow)
+	from := today.AddDate(0, 0, -10)
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", from, today, IntervalDay); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests.Load() != 2 || cacheFiles(t, dir) != 0 {
+		t.Errorf("got %d requests and %d cached files, want 2 and none", requests.Load(), cacheFiles(t, dir))
+	}
+}
+
+func TestFinalResponse(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, Moscow)
+	for url, want := range map[string]bool{
+		"https://iss.moex.com/iss/engines.csv":                          true,
+		"https://iss.moex.com/iss/candles.csv?till=2024-01-09":          true,
+		"https://iss.moex.com/iss/candles.csv?till=2024-01-09+23:59:59": true,
+		"https://iss.moex.com/iss/candles.csv?till=2024-01-10":          false,
+		"https://iss.moex.com/iss/candles.csv?till=2024-01-10+10:00:00": false,
+		"https://iss.moex.com/iss/candles.csv?till=2024-02-01":          false,
+		"https://iss.moex.com/iss/candles.csv?till=not-a-date":          false,
+	} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := final(req, now); got != want {
+			t.Errorf("%s: got %t, want %t", url, got, want)
+		}
+	}
+}
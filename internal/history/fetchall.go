@@ -0,0 +1,70 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// TickerErrors are errors of failed tickers keyed by ticker
+type TickerErrors map[string]error
+
+func (e TickerErrors) Error() string {
+	tickers := make([]string, 0, len(e))
+	for ticker := range e {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	msgs := make([]string, 0, len(tickers))
+	for _, ticker := range tickers {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", ticker, e[ticker]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FetchAll fetches candles of several tickers concurrently by Workers at a time
+// and returns them keyed by ticker. Unless FailFast is set failed tickers don't
+// stop others, candles of succeeded tickers are returned along with TickerErrors.
+func (f *Fetcher) FetchAll(
+	ctx context.Context, engine, market, board string, tickers []string, startDate, endDate time.Time, interval int,
+) (map[string][]OHLCV, error) {
+	var mu sync.Mutex
+	result := make(map[string][]OHLCV, len(tickers))
+	failed := TickerErrors{}
+
+	gr, ctx := errgroup.WithContext(ctx)
+	gr.SetLimit(NormalizeConcurrency(f.Workers))
+
+	for _, ticker := range tickers {
+		gr.Go(func() error {
+			data, err := f.Fetch(ctx, engine, market, board, ticker, startDate, endDate, interval)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if f.FailFast {
+					return errors.Wrapf(err, "fetch %s", ticker)
+				}
+				failed[ticker] = err
+				return nil
+			}
+			result[ticker] = data
+			return nil
+		})
+	}
+
+	if err := gr.Wait(); err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		return result, failed
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tickerCandles serves reversed minute candles by ticker and fails FAIL,
+// recording the maximum number of requests served at the same time
+type tickerCandles struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (s *tickerCandles) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	s.max = max(s.max, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	parts := strings.Split(r.URL.Path, "/")
+	ticker := parts[len(parts)-2]
+	if ticker == "FAIL" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data := minuteCandles(ticker, moscowTime(2024, 1, 10, 10, 0), len(ticker))
+	rows := make([]string, 0, len(data))
+	for i := len(data) - 1; i >= 0; i-- {
+		rows = append(rows, candleRow(data[i]))
+	}
+	fmt.Fprint(w, candlesCSV(candlesHeader, rows...))
+}
+
+func TestFetchAll(t *testing.T) {
+	var iss tickerCandles
+	fetcher := newTestFetcher(iss.serve)
+	fetcher.Workers = 2
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	tickers := []string{"SBER", "GAZP", "FAIL", "VTBR", "MGNT", "YNDX", "LKOH"}
+	got, err := fetcher.FetchAll(context.Background(), "stock", "shares", "TQBR", tickers, day, day, IntervalMinute1)
+
+	var failed TickerErrors
+	if !errors.As(err, &failed) || len(failed) != 1 || failed["FAIL"] == nil {
+		t.Fatalf("got error %v, want FAIL ticker error", err)
+	}
+	if code, ok := StatusCode(failed["FAIL"]); !ok || code != http.StatusNotFound {
+		t.Errorf("got FAIL error %v, want status 404", failed["FAIL"])
+	}
+
+	if len(got) != len(tickers)-1 {
+		t.Fatalf("got %d tickers, want %d", len(got), len(tickers)-1)
+	}
+	for ticker, data := range got {
+		if len(data) != len(ticker) {
+			t.Errorf("%s: got %d candles, want %d", ticker, len(data), len(ticker))
+		}
+		for i, ohlc := range data {
+			if ohlc.Ticker != ticker {
+				t.Errorf("%s: got candle of %s", ticker, ohlc.Ticker)
+			}
+			if i > 0 && !data[i-1].Date.Before(ohlc.Date) {
+				t.Errorf("%s: candle %d at %s isn't after %s", ticker, i, ohlc.Date, data[i-1].Date)
+			}
+		}
+	}
+
+	if iss.max != fetcher.Workers {
+		t.Errorf("got %d requests at once, want %d", iss.max, fetcher.Workers)
+	}
+}
+
+func TestFetchAllFailFast(t *testing.T) {
+	var iss tickerCandles
+	fetcher := newTestFetcher(iss.serve)
+	fetcher.FailFast = true
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.FetchAll(context.Background(), "stock", "shares", "TQBR", []string{"SBER", "FAIL"}, day, day, IntervalMinute1)
+	if err == nil || !strings.Contains(err.Error(), "fetch FAIL") || got != nil {
+		t.Errorf("got %d tickers and error %v, want FAIL error only", len(got), err)
+	}
+}
@@ -6,117 +6,508 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// issURL is the base URL of MOEX ISS API
+const issURL = "https://iss.moex.com/iss"
+
+// DefaultUserAgent identifies requests of this downloader to ISS
+const DefaultUserAgent = "moex-history-downloader (+https://github.com/denis-gudim/moex-history-downloader)"
+
 type OHLCV struct {
-	Date   time.Time
-	Open   float64
-	High   float64
-	Low    float64
-	Close  float64
-	Volume int64
+	Ticker string `json:"ticker,omitempty"`
+	// Date is the candle begin time
+	Date time.Time `json:"date"`
+	// End is the candle end time, zero when ISS doesn't provide it
+	End    time.Time `json:"end"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int64     `json:"volume"`
+	// Value is the turnover in rubles, zero when ISS doesn't provide it
+	Value float64 `json:"value"`
+	// OpenOI and CloseOI are open interest at the candle begin and end,
+	// provided for forts futures only
+	OpenOI  int64 `json:"openoi,omitempty"`
+	CloseOI int64 `json:"closeoi,omitempty"`
+	// AdjClose is Close adjusted for splits and dividends, see Adjust
+	AdjClose float64 `json:"adj_close,omitempty"`
 }
 
-type Fetcher struct{}
+type Fetcher struct {
+	// Client is used for ISS requests, http.DefaultClient when nil
+	Client *http.Client
+	// Retry configures repeating of failed requests
+	Retry RetryPolicy
+	// UserAgent identifies requests to ISS, DefaultUserAgent when empty
+	UserAgent string
+	// Headers are added to every ISS request, e.g. to identify a team.
+	// They replace UserAgent and other default headers of the same name.
+	Headers http.Header
+	// BeforeRequest is called before every ISS request is sent,
+	// e.g. to sign it or add headers
+	BeforeRequest func(*http.Request)
+	// AfterResponse is called for every received ISS response
+	// before its status is checked
+	AfterResponse func(*http.Response)
+	// WholeSessionsOnly excludes all candles of the current incomplete session
+	WholeSessionsOnly bool
+	// LogLevel prints requested URLs at LogDebug
+	LogLevel LogLevel
+	// ParseUTC treats ISS timestamps as UTC instead of Moscow time
+	ParseUTC bool
+	// CloseColumn selects ISS column mapped to OHLCV.Close, e.g. "legalcloseprice"
+	// for the official close. Empty means "close".
+	CloseColumn string
+	// SortColumn and SortOrder ("asc" or "desc") request server side sorting,
+	// Fetch keeps the server order instead of sorting when SortColumn is set
+	SortColumn string
+	SortOrder  string
+	// StrictSchema fails on any difference between received candles columns and
+	// the expected schema, by default only missing required columns fail
+	StrictSchema bool
+	// Limit caps number of returned candles for quick samples,
+	// pagination stops as soon as enough candles are read. Zero means no limit.
+	Limit int
+	// MaxEmptyPages caps number of consecutive empty pages skipped before
+	// pagination stops, zero means 1, i.e. it stops on the first empty page.
+	// Each skipped page advances the offset by the page size, an empty page
+	// is expected only after a full page when the candles count is a multiple
+	// of the page size.
+	MaxEmptyPages int
+	// ParallelPages is a number of pages requested concurrently once the first
+	// page reports total rows in its cursor, pages are read sequentially when
+	// it is less than 2, Limit is set or ISS doesn't report the cursor
+	ParallelPages int
+	// Cache keeps Fetch results by engine, market, board, ticker, date range,
+	// interval and options affecting the result like Limit or CloseColumn,
+	// identical requests are served from it without network. Nil disables caching.
+	Cache Cache
+	// Workers limits tickers FetchAll fetches in parallel, DefaultConcurrency
+	// when zero, negative means sequential fetching
+	Workers int
+	// FailFast stops FetchAll on the first failed ticker, by default
+	// other tickers are fetched and failures are returned as TickerErrors
+	FailFast bool
 
+	mu      sync.Mutex
+	schemas map[string]*schema
+}
+
+// Fetch returns candles of ticker for the date range reading all ISS pages,
+// or from Cache when it is set. Dates with time of day other than midnight
+// limit the range to a part of the day, e.g. the last hour. Empty board
+// selects the first board of BoardChain having candles of ticker. Result is
+// sorted by Date and Ticker in ascending order unless server side sorting is
+// requested with SortColumn.
 func (f *Fetcher) Fetch(
 	ctx context.Context, engine, market, board, ticker string, startDate, endDate time.Time, interval int,
 ) ([]OHLCV, error) {
+	if board == "" {
+		return f.fetchBoardChain(ctx, engine, market, ticker, startDate, endDate, interval)
+	}
+
+	var key string
+	if f.Cache != nil {
+		key = f.cacheKey(engine, market, board, ticker, startDate, endDate, interval)
+		if data, ok := f.Cache.Get(key); ok {
+			// Callers may modify returned candles
+			return append([]OHLCV(nil), data...), nil
+		}
+	}
+
 	var result []OHLCV
-	start := 0
 
-	for {
-		url := fmt.Sprintf(
-			"https://iss.moex.com/iss/engines/%s/markets/%s/boards/%s/securities/%s/candles.csv?from=%s&till=%s&interval=%d&start=%d",
-			engine, market, board, ticker,
-			startDate.Format("2006-01-02"),
-			endDate.Format("2006-01-02"),
-			interval, start)
+	err := f.FetchStream(ctx, engine, market, board, ticker, startDate, endDate, interval, func(ohlc OHLCV) error {
+		result = append(result, ohlc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		fmt.Println(url)
+	if f.SortColumn == "" {
+		sortCandles(result)
+	}
 
-		resp, err := http.Get(url)
-		if err != nil {
-			return nil, errors.Wrap(err, "http get")
+	if f.Cache != nil {
+		f.Cache.Set(key, append([]OHLCV(nil), result...))
+	}
+	return result, nil
+}
+
+// pageSize is the maximum number of candles ISS returns in a single page
+const pageSize = 500
+
+// errLimitReached stops pagination once Limit candles are passed to callback
+var errLimitReached = errors.New("candles limit reached")
+
+// FetchStream reads candles of ticker for the date range page by page and
+// invokes fn for every candle as soon as it is read, without buffering.
+// Candles are passed in the order ISS returns them. Error returned by fn
+// stops fetching and is returned to the caller.
+func (f *Fetcher) FetchStream(
+	ctx context.Context, engine, market, board, ticker string, startDate, endDate time.Time, interval int,
+	fn func(OHLCV) error,
+) error {
+	return f.stream(ctx, candlesRequest{
+		engine:    engine,
+		market:    market,
+		board:     board,
+		ticker:    ticker,
+		startDate: startDate,
+		endDate:   endDate,
+		interval:  interval,
+	}, fn)
+}
+
+// candlesRequest are parameters of candles request
+type candlesRequest struct {
+	engine, market, board, ticker string
+	startDate, endDate            time.Time
+	interval                      int
+	// session selects trading session, all sessions when empty
+	session string
+}
+
+// ErrInvalidDateRange is returned for date ranges with zero bounds
+// or start date after end date
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+// ValidateDateRange returns ErrInvalidDateRange unless both dates are set and
+// startDate doesn't follow endDate. ISS silently returns no candles for such
+// ranges. Equal dates are valid and request a single day.
+func ValidateDateRange(startDate, endDate time.Time) error {
+	if startDate.IsZero() || endDate.IsZero() || startDate.After(endDate) {
+		return errors.Wrapf(ErrInvalidDateRange, "from %s till %s",
+			issTime(startDate, Moscow), issTime(endDate, Moscow))
+	}
+	return nil
+}
+
+// stream reads candles page by page passing them to fn, see FetchStream
+func (f *Fetcher) stream(ctx context.Context, req candlesRequest, fn func(OHLCV) error) error {
+	if err := ValidateInterval(req.interval); err != nil {
+		return err
+	}
+	if err := ValidateDateRange(req.startDate, req.endDate); err != nil {
+		return err
+	}
+
+	location := f.location()
+	session := sessionStart(time.Now(), location)
+
+	var count int
+	emit := func(ohlc OHLCV) error {
+		if f.WholeSessionsOnly && !ohlc.Date.Before(session) {
+			return nil
+		}
+		if f.Limit > 0 && count >= f.Limit {
+			return errLimitReached
 		}
-		defer resp.Body.Close()
+		count++
+		return fn(ohlc)
+	}
+
+	start, empty := 0, 0
+	schemaKey := fmt.Sprintf("%s/%s/candles", req.engine, req.market)
 
-		reader := csv.NewReader(resp.Body)
-		reader.Comma = ';'
-		if _, err := reader.Read(); err != nil {
-			return nil, errors.Wrap(err, "skip csv header rows")
+	if f.ParallelPages > 1 && f.Limit == 0 {
+		next, err := f.parallelPages(ctx, schemaKey, req, location, emit)
+		if err != nil || next == 0 {
+			return err
 		}
+		start = next
+	}
 
-		reader.FieldsPerRecord = 0
-		columns := make(map[string]int)
-		column, err := reader.Read()
-		if err != nil {
-			return nil, errors.Wrap(err, "read csv header columns")
+	for {
+		batchSize, _, err := f.readPage(ctx, schemaKey, req, start, location, emit)
+		if err == errLimitReached {
+			return nil
 		}
-		for indx, name := range column {
-			columns[name] = indx
+		if err != nil {
+			return err
 		}
 
-		var batchSize int
-		for {
-			row, err := reader.Read()
-			if err == io.EOF {
+		if batchSize == 0 {
+			// empty page is skipped only while the limit allows, the same
+			// offset is never requested twice
+			empty++
+			if empty >= f.maxEmptyPages() {
 				break
 			}
-			if err != nil {
-				return nil, errors.Wrap(err, "read csv row")
-			}
+			start += pageSize
+			continue
+		}
+		empty = 0
+		// partial page is the last one, no more requests are needed
+		if batchSize < pageSize {
+			break
+		}
+		if f.Limit > 0 && count >= f.Limit {
+			break
+		}
+		start += batchSize
+	}
 
-			date, err := time.Parse("2006-01-02 15:04:05", row[columns["begin"]])
-			if err != nil {
-				return nil, errors.Wrap(err, "parse date column")
-			}
+	return nil
+}
 
-			open, err := strconv.ParseFloat(row[columns["open"]], 64)
-			if err != nil {
-				return nil, errors.Wrap(err, "parse open column")
-			}
+// location returns time zone ISS timestamps are parsed in
+func (f *Fetcher) location() *time.Location {
+	if f.ParseUTC {
+		return time.UTC
+	}
+	return Moscow
+}
 
-			high, err := strconv.ParseFloat(row[columns["high"]], 64)
-			if err != nil {
-				return nil, errors.Wrap(err, "parse high column")
-			}
+// maxEmptyPages returns MaxEmptyPages or 1 when it isn't set
+func (f *Fetcher) maxEmptyPages() int {
+	if f.MaxEmptyPages < 1 {
+		return 1
+	}
+	return f.MaxEmptyPages
+}
 
-			low, err := strconv.ParseFloat(row[columns["low"]], 64)
-			if err != nil {
-				return nil, errors.Wrap(err, "parse low column")
+// CandlesURL returns url of the first candles page Fetch requests for
+// ticker and the date range, following pages differ by start parameter only
+func (f *Fetcher) CandlesURL(
+	engine, market, board, ticker string, startDate, endDate time.Time, interval int,
+) string {
+	return f.candlesURL(candlesRequest{
+		engine:    engine,
+		market:    market,
+		board:     board,
+		ticker:    ticker,
+		startDate: startDate,
+		endDate:   endDate,
+		interval:  interval,
+	}, 0)
+}
+
+// issTime formats from and till request parameter. Midnight keeps date only
+// requesting the whole day, other times are converted to location ISS
+// timestamps are given in and passed with time to request a part of the day.
+func issTime(date time.Time, location *time.Location) string {
+	if date.Equal(sessionStart(date, date.Location())) {
+		return date.Format("2006-01-02")
+	}
+	return date.In(location).Format("2006-01-02 15:04:05")
+}
+
+// candlesURL builds candles page url starting at start row
+func (f *Fetcher) candlesURL(req candlesRequest, start int) string {
+	query := url.Values{}
+	query.Set("from", issTime(req.startDate, f.location()))
+	query.Set("till", issTime(req.endDate, f.location()))
+	query.Set("interval", strconv.Itoa(req.interval))
+	query.Set("start", strconv.Itoa(start))
+	if req.session != "" {
+		query.Set("tradingsession", req.session)
+	}
+	if f.SortColumn != "" {
+		query.Set("sort_column", f.SortColumn)
+	}
+	if f.SortOrder != "" {
+		query.Set("sort_order", f.SortOrder)
+	}
+
+	return fmt.Sprintf("%s/engines/%s/markets/%s/boards/%s/securities/%s/candles.csv?%s",
+		issURL, req.engine, req.market, req.board, req.ticker, query.Encode())
+}
+
+// FetchError is an error of a candles page request or of its row parsing,
+// it identifies the failed ticker, date range and page
+type FetchError struct {
+	Ticker string
+	From   time.Time
+	Till   time.Time
+	// URL is the failed page url
+	URL string
+	// Row is the 1-based number of the failed candles row counted from
+	// the first page, zero for errors of the whole page
+	Row int
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	msg := fmt.Sprintf("fetch %s from %s till %s", e.Ticker, issTime(e.From, Moscow), issTime(e.Till, Moscow))
+	if e.Row > 0 {
+		msg += fmt.Sprintf(" row %d", e.Row)
+	}
+	return fmt.Sprintf("%s (%s): %v", msg, e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// readPage requests a single candles page starting at start row and passes
+// parsed rows to fn, returns number of rows in the page and cursor block when
+// ISS sends it. Errors other than returned by fn are FetchError.
+func (f *Fetcher) readPage(
+	ctx context.Context, schemaKey string, req candlesRequest, start int, location *time.Location, fn func(OHLCV) error,
+) (int, *Cursor, error) {
+	url := f.candlesURL(req, start)
+	f.LogLevel.logf(LogDebug, "%s", url)
+
+	fail := func(row int, err error) error {
+		return &FetchError{Ticker: req.ticker, From: req.startDate, Till: req.endDate, URL: url, Row: row, Err: err}
+	}
+
+	resp, err := f.get(ctx, req.ticker, url)
+	if err != nil {
+		return 0, nil, fail(0, err)
+	}
+	defer resp.Body.Close()
+
+	reader := csv.NewReader(resp.Body)
+	reader.Comma = ';'
+	if _, err := reader.Read(); err != nil {
+		return 0, nil, fail(0, errors.Wrap(err, "skip csv header rows"))
+	}
+
+	// Field counts are checked manually to stop at the next block, e.g. cursor
+	reader.FieldsPerRecord = -1
+	column, err := reader.Read()
+	if err != nil {
+		return 0, nil, fail(0, errors.Wrap(err, "read csv header columns"))
+	}
+	columns, err := f.resolveSchema(schemaKey, column)
+	if err != nil {
+		return 0, nil, fail(0, err)
+	}
+	closeIndx := columns[f.closeColumn()]
+
+	var batchSize int
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "read csv row"))
+		}
+		// Blank line separated block follows candles, it begins with block name
+		if len(row) != len(column) {
+			name, ok := blockName(row)
+			if !ok {
+				return batchSize, nil, fail(start+batchSize+1,
+					errors.Errorf("got %d fields in csv row, want %d", len(row), len(column)))
 			}
+			if strings.HasSuffix(name, ".cursor") {
+				cursor, err := readCursor(reader)
+				if err != nil {
+					return batchSize, nil, fail(0, err)
+				}
+				return batchSize, cursor, nil
+			}
+			break
+		}
+
+		date, err := time.ParseInLocation("2006-01-02 15:04:05", row[columns["begin"]], location)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse date column"))
+		}
 
-			close, err := strconv.ParseFloat(row[columns["close"]], 64)
+		var end time.Time
+		if indx, ok := columns["end"]; ok {
+			end, err = time.ParseInLocation("2006-01-02 15:04:05", row[indx], location)
 			if err != nil {
-				return nil, errors.Wrap(err, "parse close column")
+				return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse end column"))
 			}
+		}
+
+		open, err := strconv.ParseFloat(row[columns["open"]], 64)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse open column"))
+		}
+
+		high, err := strconv.ParseFloat(row[columns["high"]], 64)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse high column"))
+		}
+
+		low, err := strconv.ParseFloat(row[columns["low"]], 64)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse low column"))
+		}
+
+		close, err := strconv.ParseFloat(row[closeIndx], 64)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse close column"))
+		}
+
+		volume, err := strconv.ParseInt(row[columns["volume"]], 10, 64)
+		if err != nil {
+			return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse volume column"))
+		}
 
-			volume, err := strconv.ParseInt(row[columns["volume"]], 10, 64)
+		var value float64
+		if indx, ok := columns["value"]; ok {
+			value, err = strconv.ParseFloat(row[indx], 64)
 			if err != nil {
-				return nil, errors.Wrap(err, "parse volume column")
+				return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse value column"))
 			}
+		}
 
-			result = append(result, OHLCV{
-				Date:   date,
-				Open:   open,
-				High:   high,
-				Low:    low,
-				Close:  close,
-				Volume: volume,
-			})
-			batchSize++
+		var openOI, closeOI int64
+		if indx, ok := columns["openoi"]; ok {
+			if openOI, err = parseOI(row[indx]); err != nil {
+				return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse openoi column"))
+			}
+		}
+		if indx, ok := columns["closeoi"]; ok {
+			if closeOI, err = parseOI(row[indx]); err != nil {
+				return batchSize, nil, fail(start+batchSize+1, errors.Wrap(err, "parse closeoi column"))
+			}
 		}
 
-		if batchSize < 500 {
-			break
+		err = fn(OHLCV{
+			Ticker:  req.ticker,
+			Date:    date,
+			End:     end,
+			Open:    open,
+			High:    high,
+			Low:     low,
+			Close:   close,
+			Volume:  volume,
+			Value:   value,
+			OpenOI:  openOI,
+			CloseOI: closeOI,
+		})
+		if err != nil {
+			return batchSize, nil, err
 		}
-		start += batchSize
+		batchSize++
 	}
 
-	return result, nil
+	return batchSize, nil, nil
+}
+
+// parseOI parses open interest column, empty value means zero
+func parseOI(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// sortCandles stable sorts candles by Date and Ticker
+func sortCandles(data []OHLCV) {
+	sort.SliceStable(data, func(i, j int) bool {
+		if !data[i].Date.Equal(data[j].Date) {
+			return data[i].Date.Before(data[j].Date)
+		}
+		return data[i].Ticker < data[j].Ticker
+	})
 }
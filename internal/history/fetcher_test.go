@@ -0,0 +1,475 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// candlesHeader is candles.csv columns line of ISS
+const candlesHeader = "open;close;high;low;value;volume;begin;end"
+
+// handlerTransport serves requests with handler in process,
+// so tests answer ISS requests without network. Like network transports
+// it fails requests whose context is done.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+// roundTripFunc is a transport returning arbitrary responses or errors
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+// newTestFetcher returns Fetcher answering ISS requests with handler
+func newTestFetcher(handler http.HandlerFunc) *Fetcher {
+	return &Fetcher{Client: &http.Client{Transport: handlerTransport{handler: handler}}}
+}
+
+// candlesCSV renders candles.csv response of rows with header columns
+func candlesCSV(header string, rows ...string) string {
+	var b strings.Builder
+	b.WriteString("candles\n")
+	b.WriteString(header + "\n")
+	for _, row := range rows {
+		b.WriteString(row + "\n")
+	}
+	return b.String()
+}
+
+// candleRow renders candle as candlesHeader row in Moscow time
+func candleRow(ohlc OHLCV) string {
+	date := ohlc.Date.In(Moscow)
+	end := date.Add(59 * time.Second)
+	return strings.Join([]string{
+		strconv.FormatFloat(ohlc.Open, 'f', -1, 64),
+		strconv.FormatFloat(ohlc.Close, 'f', -1, 64),
+		strconv.FormatFloat(ohlc.High, 'f', -1, 64),
+		strconv.FormatFloat(ohlc.Low, 'f', -1, 64),
+		strconv.FormatFloat(ohlc.Value, 'f', -1, 64),
+		strconv.FormatInt(ohlc.Volume, 10),
+		date.Format("2006-01-02 15:04:05"),
+		end.Format("2006-01-02 15:04:05"),
+	}, ";")
+}
+
+// minuteCandles returns n consecutive minute candles of ticker beginning at
+// begin with prices growing by one per candle
+func minuteCandles(ticker string, begin time.Time, n int) []OHLCV {
+	data := make([]OHLCV, n)
+	for i := range data {
+		price := float64(100 + i)
+		data[i] = OHLCV{
+			Ticker: ticker,
+			Date:   begin.Add(time.Duration(i) * time.Minute),
+			Open:   price,
+			High:   price + 1,
+			Low:    price - 1,
+			Close:  price + 0.5,
+			Volume: int64(10 + i),
+		}
+	}
+	return data
+}
+
+// servePages answers candles requests with pages of data by start parameter
+func servePages(data []OHLCV) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		rows := make([]string, 0, pageSize)
+		for i := start; i < len(data) && i < start+pageSize; i++ {
+			rows = append(rows, candleRow(data[i]))
+		}
+		fmt.Fprint(w, candlesCSV(candlesHeader, rows...))
+	}
+}
+
+// countRequests wraps handler counting requests it serves
+func countRequests(count *atomic.Int32, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		handler(w, r)
+	}
+}
+
+// moscowTime returns time of Moscow wall clock
+func moscowTime(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, Moscow)
+}
+
+func TestFetchSortsAcrossPages(t *testing.T) {
+	begin := moscowTime(2024, 1, 10, 10, 0)
+	data := minuteCandles("SBER", begin, pageSize+50)
+	// The second page holds the earliest candles as if the cursor wrapped
+	served := append(append([]OHLCV(nil), data[50:]...), data[:50]...)
+	fetcher := newTestFetcher(servePages(served))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(data) {
+		t.Fatalf("got %d candles, want %d", len(got), len(data))
+	}
+	for i := range got {
+		if !got[i].Date.Equal(data[i].Date) {
+			t.Fatalf("candle %d at %s, want %s", i, got[i].Date, data[i].Date)
+		}
+	}
+}
+
+func TestSortCandlesByDateAndTicker(t *testing.T) {
+	date := moscowTime(2024, 1, 10, 10, 0)
+	data := []OHLCV{
+		{Ticker: "SiM4", Date: date.Add(time.Minute)},
+		{Ticker: "SiM4", Date: date},
+		{Ticker: "SiH4", Date: date, Close: 1},
+		{Ticker: "SiH4", Date: date, Close: 2},
+	}
+
+	sortCandles(data)
+
+	want := []OHLCV{
+		{Ticker: "SiH4", Date: date, Close: 1},
+		{Ticker: "SiH4", Date: date, Close: 2},
+		{Ticker: "SiM4", Date: date},
+		{Ticker: "SiM4", Date: date.Add(time.Minute)},
+	}
+	for i := range want {
+		if data[i].Ticker != want[i].Ticker || !data[i].Date.Equal(want[i].Date) || data[i].Close != want[i].Close {
+			t.Errorf("candle %d: got %s %s %v, want %s %s %v", i,
+				data[i].Ticker, data[i].Date, data[i].Close, want[i].Ticker, want[i].Date, want[i].Close)
+		}
+	}
+}
+
+func TestWholeSessionsOnlyExcludesToday(t *testing.T) {
+	today := sessionStart(time.Now(), Moscow)
+	yesterday := today.AddDate(0, 0, -1)
+	data := append(
+		minuteCandles("SBER", yesterday.Add(23*time.Hour+50*time.Minute), 3),
+		minuteCandles("SBER", today, 3)...,
+	)
+	fetcher := newTestFetcher(servePages(data))
+	fetcher.WholeSessionsOnly = true
+
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", yesterday, today, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d candles, want 3 of the previous session", len(got))
+	}
+	for _, ohlc := range got {
+		if !ohlc.Date.Before(today) {
+			t.Errorf("candle of the current session %s is returned", ohlc.Date)
+		}
+	}
+}
+
+func TestFetchParsesMoscowTime(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader, "1;1;1;1;0;1;2024-07-01 10:00:00;2024-07-01 10:00:59"))
+	})
+
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MSK is UTC+3 all year round since 2014
+	if want := time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC); !got[0].Date.Equal(want) {
+		t.Errorf("got %s, want %s", got[0].Date.UTC(), want)
+	}
+	if want := time.Date(2024, 7, 1, 7, 0, 59, 0, time.UTC); !got[0].End.Equal(want) {
+		t.Errorf("got end %s, want %s", got[0].End.UTC(), want)
+	}
+
+	fetcher.ParseUTC = true
+	got, err = fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC); !got[0].Date.Equal(want) {
+		t.Errorf("got %s with ParseUTC, want %s", got[0].Date, want)
+	}
+}
+
+func TestFetchLimit(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 2*pageSize+10)
+	var requests atomic.Int32
+	fetcher := newTestFetcher(countRequests(&requests, servePages(data)))
+	fetcher.Limit = 7
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 7 {
+		t.Fatalf("got %d candles, want 7", len(got))
+	}
+	if !got[0].Date.Equal(data[0].Date) || !got[6].Date.Equal(data[6].Date) {
+		t.Errorf("got candles from %s till %s, want the first ones", got[0].Date, got[6].Date)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+}
+
+func TestFetchCloseColumn(t *testing.T) {
+	header := "open;close;high;low;value;volume;begin;end;legalcloseprice"
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(header, "1;2;3;0.5;0;1;2024-07-01 10:00:00;2024-07-01 10:00:59;2.25"))
+	})
+
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Close != 2 {
+		t.Errorf("got close %v, want close column 2", got[0].Close)
+	}
+
+	fetcher.CloseColumn = "legalcloseprice"
+	got, err = fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Close != 2.25 {
+		t.Errorf("got close %v, want legalcloseprice 2.25", got[0].Close)
+	}
+}
+
+func TestFetchServerSortOrder(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3)
+	descending := []OHLCV{data[2], data[1], data[0]}
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("sort_column") != "begin" || query.Get("sort_order") != "desc" {
+			t.Errorf("got sort_column %q and sort_order %q", query.Get("sort_column"), query.Get("sort_order"))
+		}
+		servePages(descending)(w, r)
+	})
+	fetcher.SortColumn = "begin"
+	fetcher.SortOrder = "desc"
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(descending) {
+		t.Fatalf("got %d candles, want %d", len(got), len(descending))
+	}
+	for i := range got {
+		if !got[i].Date.Equal(descending[i].Date) {
+			t.Errorf("candle %d at %s, want server order %s", i, got[i].Date, descending[i].Date)
+		}
+	}
+}
+
+func TestRequestHooks(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), pageSize+1)
+	var signed atomic.Int32
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signature") == "start="+r.URL.Query().Get("start") {
+			signed.Add(1)
+		}
+		servePages(data)(w, r)
+	})
+
+	var before, after []string
+	fetcher.BeforeRequest = func(r *http.Request) {
+		before = append(before, r.URL.Query().Get("start"))
+		r.Header.Set("X-Signature", "start="+r.URL.Query().Get("start"))
+	}
+	fetcher.AfterResponse = func(resp *http.Response) {
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("got status %d", resp.StatusCode)
+		}
+		after = append(after, resp.Request.URL.Query().Get("start"))
+	}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"0", strconv.Itoa(pageSize)}
+	if strings.Join(before, ",") != strings.Join(want, ",") {
+		t.Errorf("BeforeRequest got starts %v, want %v", before, want)
+	}
+	if strings.Join(after, ",") != strings.Join(want, ",") {
+		t.Errorf("AfterResponse got starts %v, want %v", after, want)
+	}
+	if n := signed.Load(); n != 2 {
+		t.Errorf("%d requests carry header set by BeforeRequest, want 2", n)
+	}
+}
+
+func TestFetchMinimalRequests(t *testing.T) {
+	tests := []struct {
+		candles  int
+		requests int32
+	}{
+		{0, 1},
+		{10, 1},
+		// Full page is followed by a single empty one
+		{pageSize, 2},
+		{2*pageSize + 3, 3},
+	}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		data := minuteCandles("SBER", moscowTime(2024, 1, 10, 0, 0), tt.candles)
+		var requests atomic.Int32
+		fetcher := newTestFetcher(countRequests(&requests, servePages(data)))
+
+		got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.candles {
+			t.Errorf("%d candles: got %d", tt.candles, len(got))
+		}
+		if n := requests.Load(); n != tt.requests {
+			t.Errorf("%d candles: made %d requests, want %d", tt.candles, n, tt.requests)
+		}
+	}
+}
+
+func TestFetchMaxEmptyPagesAdvances(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 0, 0), 2*pageSize+3)
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		maxEmpty int
+		starts   []string
+		candles  int
+	}{
+		// The first empty page stops pagination by default
+		{0, []string{"0", strconv.Itoa(pageSize)}, pageSize},
+		{2, []string{"0", strconv.Itoa(pageSize), strconv.Itoa(2 * pageSize)}, pageSize + 3},
+	} {
+		var starts []string
+		fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+			start := r.URL.Query().Get("start")
+			starts = append(starts, start)
+			if start == strconv.Itoa(pageSize) {
+				servePages(nil)(w, r)
+				return
+			}
+			servePages(data)(w, r)
+		})
+		fetcher.MaxEmptyPages = tt.maxEmpty
+
+		got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.candles {
+			t.Errorf("max %d: got %d candles, want %d", tt.maxEmpty, len(got), tt.candles)
+		}
+		if strings.Join(starts, ",") != strings.Join(tt.starts, ",") {
+			t.Errorf("max %d: requested starts %v, want %v", tt.maxEmpty, starts, tt.starts)
+		}
+	}
+}
+
+func TestFetchInvalidDateRange(t *testing.T) {
+	var requests atomic.Int32
+	fetcher := newTestFetcher(countRequests(&requests, servePages(nil)))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	ranges := [][2]time.Time{
+		{day, day.AddDate(0, 0, -1)},
+		{time.Time{}, day},
+		{day, time.Time{}},
+	}
+	for _, r := range ranges {
+		_, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", r[0], r[1], IntervalMinute1)
+		if !errors.Is(err, ErrInvalidDateRange) {
+			t.Errorf("from %s till %s: got %v, want ErrInvalidDateRange", r[0], r[1], err)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("made %d requests of invalid ranges", n)
+	}
+
+	// A single day range is valid
+	if err := ValidateDateRange(day, day); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchFortsOpenInterest(t *testing.T) {
+	var path string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, candlesCSV("open;close;high;low;value;volume;openoi;closeoi;begin;end",
+			"90000;90100;90200;89900;0;15;120350;120410;2024-01-10 10:00:00;2024-01-10 10:00:59",
+			"90100;90050;90150;90000;0;7;120410;;2024-01-10 10:01:00;2024-01-10 10:01:59",
+		))
+	})
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "futures", "forts", "RFUD", "SiH4", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(path, "/engines/futures/markets/forts/") {
+		t.Errorf("requested %s", path)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d candles, want 2", len(got))
+	}
+	if got[0].OpenOI != 120350 || got[0].CloseOI != 120410 {
+		t.Errorf("got open interest %d/%d, want 120350/120410", got[0].OpenOI, got[0].CloseOI)
+	}
+	// Empty value means no open interest reported for the candle
+	if got[1].OpenOI != 120410 || got[1].CloseOI != 0 {
+		t.Errorf("got open interest %d/%d, want 120410/0", got[1].OpenOI, got[1].CloseOI)
+	}
+}
+
+func TestFetchWithoutOpenInterest(t *testing.T) {
+	fetcher := newTestFetcher(servePages(minuteCandles("SiH4", moscowTime(2024, 1, 10, 10, 0), 1)))
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "futures", "forts", "RFUD", "SiH4", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].OpenOI != 0 || got[0].CloseOI != 0 {
+		t.Errorf("got %+v, want one candle without open interest", got)
+	}
+}
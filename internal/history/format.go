@@ -0,0 +1,101 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OutputFormat selects rows format of FetchToWriter
+type OutputFormat int
+
+const (
+	// FormatCSV writes DefaultWriter layout with header
+	FormatCSV OutputFormat = iota
+	// FormatNDJSON writes a JSON candle object per line
+	FormatNDJSON
+	// FormatJSON writes a JSON array of candle objects
+	FormatJSON
+)
+
+// FetchToWriter fetches candles of ticker for the date range page by page and
+// writes them to w in format as they arrive, without buffering the series,
+// e.g. into an HTTP response or os.Stdout. Candles are written in the order
+// ISS returns them. Empty board selects the first board of BoardChain having
+// candles in the date range, like Fetch does.
+func (f *Fetcher) FetchToWriter(
+	ctx context.Context, engine, market, board, ticker string, startDate, endDate time.Time, interval int,
+	w io.Writer, format OutputFormat,
+) error {
+	out := bufio.NewWriter(w)
+
+	var write func(OHLCV) error
+	switch format {
+	case FormatCSV:
+		writer := DefaultWriter()
+		if err := writer.WriteHeaderTo(out); err != nil {
+			return errors.Wrap(err, "write header")
+		}
+		write = func(ohlc OHLCV) error {
+			_, err := io.WriteString(out, writer.Row(ohlc))
+			return err
+		}
+	case FormatNDJSON:
+		encoder := json.NewEncoder(out)
+		write = func(ohlc OHLCV) error {
+			return encoder.Encode(ohlc)
+		}
+	case FormatJSON:
+		if _, err := io.WriteString(out, "["); err != nil {
+			return errors.Wrap(err, "write array start")
+		}
+		separator := ""
+		write = func(ohlc OHLCV) error {
+			content, err := json.Marshal(ohlc)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(out, separator); err != nil {
+				return err
+			}
+			separator = ","
+			_, err = out.Write(content)
+			return err
+		}
+	default:
+		return errors.Errorf("unknown output format %d", format)
+	}
+
+	boards := []string{board}
+	if board == "" {
+		if boards = BoardChain(engine, market); len(boards) == 0 {
+			return errors.Errorf("no boards registered for %s/%s", engine, market)
+		}
+	}
+
+	var count int
+	counted := func(ohlc OHLCV) error {
+		count++
+		return write(ohlc)
+	}
+	for _, board := range boards {
+		err := f.FetchStream(ctx, engine, market, board, ticker, startDate, endDate, interval, counted)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			break
+		}
+	}
+
+	if format == FormatJSON {
+		if _, err := io.WriteString(out, "]\n"); err != nil {
+			return errors.Wrap(err, "write array end")
+		}
+	}
+	return errors.Wrap(out.Flush(), "flush output")
+}
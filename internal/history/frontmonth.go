@@ -0,0 +1,62 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// FrontMonth builds continuous futures series from contracts candles keyed by
+// ticker. For every timestamp the nearest-to-expiry contract that is not expired
+// yet (timestamp is before its expiry) is selected and its bar is used,
+// timestamps the front contract has no bar for are skipped. Contracts without
+// expiry are ignored. Result is sorted by Date.
+func FrontMonth(contracts map[string][]OHLCV, expiries map[string]time.Time) []OHLCV {
+	type contract struct {
+		expiry time.Time
+		bars   map[int64]OHLCV
+	}
+
+	var active []contract
+	stamps := make(map[int64]time.Time)
+	for ticker, data := range contracts {
+		expiry, ok := expiries[ticker]
+		if !ok {
+			continue
+		}
+		c := contract{expiry: expiry, bars: make(map[int64]OHLCV, len(data))}
+		for _, ohlc := range data {
+			key := ohlc.Date.UnixNano()
+			c.bars[key] = ohlc
+			stamps[key] = ohlc.Date
+		}
+		active = append(active, c)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].expiry.Before(active[j].expiry)
+	})
+
+	dates := make([]time.Time, 0, len(stamps))
+	for _, date := range stamps {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var result []OHLCV
+	front := 0
+	for _, date := range dates {
+		for front < len(active) && !date.Before(active[front].expiry) {
+			front++
+		}
+		if front == len(active) {
+			break
+		}
+		if ohlc, ok := active[front].bars[date.UnixNano()]; ok {
+			result = append(result, ohlc)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrontMonthRollsAtExpiry(t *testing.T) {
+	day := func(d int) time.Time { return moscowTime(2024, 3, d, 0, 0) }
+	daily := func(ticker string, from, till int, close float64) []OHLCV {
+		var data []OHLCV
+		for d := from; d <= till; d++ {
+			data = append(data, OHLCV{Ticker: ticker, Date: day(d), Close: close})
+		}
+		return data
+	}
+
+	// Both contracts trade from 18th till 21st, March one expires at the
+	// beginning of 21st so June one is the front month since then
+	contracts := map[string][]OHLCV{
+		"SiH4": daily("SiH4", 18, 21, 1),
+		"SiM4": daily("SiM4", 18, 24, 2),
+	}
+	expiries := map[string]time.Time{
+		"SiH4": day(21),
+		"SiM4": moscowTime(2024, 6, 20, 0, 0),
+	}
+
+	got := FrontMonth(contracts, expiries)
+
+	want := []string{"SiH4", "SiH4", "SiH4", "SiM4", "SiM4", "SiM4", "SiM4"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+	for i, ticker := range want {
+		if got[i].Ticker != ticker || !got[i].Date.Equal(day(18+i)) {
+			t.Errorf("candle %d: got %s at %s, want %s at %s", i, got[i].Ticker, got[i].Date, ticker, day(18+i))
+		}
+	}
+}
+
+func TestFrontMonthSkipsContractsWithoutExpiry(t *testing.T) {
+	date := moscowTime(2024, 3, 18, 0, 0)
+	contracts := map[string][]OHLCV{"SiH4": {{Ticker: "SiH4", Date: date}}}
+
+	if got := FrontMonth(contracts, nil); len(got) != 0 {
+		t.Errorf("got %d candles of contract without expiry", len(got))
+	}
+}
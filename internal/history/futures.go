@@ -0,0 +1,257 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Futures market coordinates on MOEX ISS
+const (
+	FuturesEngine = "futures"
+	FuturesMarket = "forts"
+	FuturesBoard  = "RFUD"
+)
+
+var (
+	// codes are quarterly contract month codes in expiration order
+	codes = []string{"H", "M", "U", "Z"}
+	// codeMonths maps quarterly contract codes to expiration months
+	codeMonths = map[string]int{"H": 3, "M": 6, "U": 9, "Z": 12}
+	// serialCodes are monthly contract codes from January to December
+	serialCodes = []string{"F", "G", "H", "J", "K", "M", "N", "Q", "U", "V", "X", "Z"}
+)
+
+// ThirdFriday returns the third Friday of given year and month,
+// the expiration date of quarterly futures contracts
+func ThirdFriday(year int, month int) time.Time {
+	third := time.Date(year, time.Month(month), 15, 0, 0, 0, 0, time.UTC)
+	weekday := third.Weekday()
+	daysUntilFriday := (5 - weekday + 7) % 7
+	return third.AddDate(0, 0, int(daysUntilFriday))
+}
+
+// FuturesExpiry returns ticker of the quarterly contract of root expiring in
+// the code month (H/M/U/Z for Mar/Jun/Sep/Dec) of year, and the trading window
+// downloaded for it: from the day before previous quarterly expiration till two
+// days before its own third Friday expiration. Unknown code yields empty ticker.
+func FuturesExpiry(contract string, code string, year int) (ticker string, begin, end time.Time) {
+	m, ok := codeMonths[code]
+	if !ok {
+		return "", time.Time{}, time.Time{}
+	}
+
+	yBegin := year
+	mBegin := m - 3
+	if mBegin == 0 {
+		mBegin = 12
+		yBegin--
+	}
+
+	begin = ThirdFriday(yBegin, mBegin).AddDate(0, 0, -1)
+	end = ThirdFriday(year, m).AddDate(0, 0, -2)
+	ticker = FuturesTicker(contract, code, year, 1)
+
+	return ticker, begin, end
+}
+
+// FuturesTicker returns contract ticker with year suffix of given digits width,
+// e.g. SiH6 for one digit and SiH26 for two. ISS security codes use a single
+// digit, so tickers ten years apart coincide and are told apart by the date
+// window only, wider suffixes are meant for identifying contracts in output.
+func FuturesTicker(contract, code string, year, digits int) string {
+	if digits < 1 {
+		digits = 1
+	}
+
+	mod := 1
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%s%s%0*d", contract, code, digits, year%mod)
+}
+
+// ExpandContracts returns tickers of root contracts expiring in years from
+// yearBegin up to but not including yearEnd, the same range ProcessFutures
+// downloads. Quarterly contracts are returned unless serial is set, which
+// expands into contracts of every month.
+func ExpandContracts(root string, yearBegin, yearEnd int, serial bool) []string {
+	monthCodes := codes
+	if serial {
+		monthCodes = serialCodes
+	}
+
+	var tickers []string
+	for y := yearBegin; y < yearEnd; y++ {
+		for _, code := range monthCodes {
+			tickers = append(tickers, FuturesTicker(root, code, y, 1))
+		}
+	}
+	return tickers
+}
+
+// ProcessFutures downloads quarterly contracts of futures roots for given
+// year range, all contracts of a root are written into a single file.
+// Failed roots don't stop others unless FailFast is set, their errors
+// are joined into the returned error.
+func ProcessFutures(
+	ctx context.Context, fetcher *Fetcher, opts ProcessOptions, yearBegin, yearEnd int, contracts ...string,
+) (*Report, error) {
+	opts = opts.withIntervalLayout().withFetcherLocation(fetcher)
+
+	dir, err := outputDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	started := time.Now()
+
+	runCtx, cancel := opts.withMaxRuntime(ctx)
+	defer cancel()
+
+	gr, ctx := errgroup.WithContext(runCtx)
+	gr.SetLimit(NormalizeConcurrency(opts.Concurrency))
+
+	for _, contract := range contracts {
+		gr.Go(func() error {
+			return track(opts, report, contract, func() (TickerResult, error) {
+				return processFuturesRoot(ctx, fetcher, opts, dir, contract, yearBegin, yearEnd)
+			})
+		})
+
+	}
+
+	return report, finishRun(runCtx, opts, dir, report, started, gr.Wait())
+}
+
+// processFuturesRoot downloads all contracts of a single futures root into its
+// file, or into a file per year with SplitByYear
+func processFuturesRoot(
+	ctx context.Context, fetcher *Fetcher, opts ProcessOptions, dir, contract string, yearBegin, yearEnd int,
+) (TickerResult, error) {
+	result := TickerResult{Ticker: contract}
+
+	var lastDate time.Time
+	if opts.SplitByYear {
+		for y := yearBegin; y < yearEnd; y++ {
+			if err := processFuturesFile(ctx, fetcher, opts, dir, contract, y, y+1, &result, &lastDate); err != nil {
+				return result, err
+			}
+		}
+	} else {
+		if err := processFuturesFile(ctx, fetcher, opts, dir, contract, yearBegin, yearEnd, &result, &lastDate); err != nil {
+			return result, err
+		}
+	}
+
+	result.UnderCovered = result.Rows < opts.MinBars && !opts.DryRun
+
+	return result, nil
+}
+
+// processFuturesFile downloads root contracts expiring in years from yearBegin
+// up to yearEnd into a single file. Unless Force is set data is written into
+// a temporary file which replaces the existing one only after all periods succeed.
+func processFuturesFile(
+	ctx context.Context, fetcher *Fetcher, opts ProcessOptions, dir, contract string, yearBegin, yearEnd int,
+	result *TickerResult, lastDate *time.Time,
+) error {
+	engine, market, board := opts.coordinates(FuturesEngine, FuturesMarket, FuturesBoard)
+
+	// Create one file per contract
+	fileName, err := outputPath(dir, opts, pathVars{ticker: contract, board: board, year: yearBegin})
+	if err != nil {
+		return err
+	}
+	result.FileName = fileName
+
+	if opts.DryRun {
+		for y := yearBegin; y < yearEnd; y++ {
+			for _, code := range codes {
+				ticker, beginDate, endDate := FuturesExpiry(contract, code, y)
+				if notTradedYet(opts, ticker, beginDate) {
+					continue
+				}
+				planRequest(opts, result, fetcher.CandlesURL(engine, market, board, ticker, beginDate, endDate, opts.Interval), fileName)
+			}
+		}
+		return nil
+	}
+
+	file, err := createSink(contract, fileName, opts, -1)
+	if err != nil {
+		return err
+	}
+
+	gaps := &coverage{interval: opts.Interval}
+
+	for y := yearBegin; y < yearEnd; y++ {
+		for _, code := range codes {
+			ticker, beginDate, endDate := FuturesExpiry(contract, code, y)
+
+			// Skip contracts not trading yet
+			if notTradedYet(opts, ticker, beginDate) {
+				continue
+			}
+
+			data, err := fetcher.Fetch(ctx, engine, market, board, ticker, beginDate, endDate, opts.Interval)
+			if err != nil {
+				file.abort()
+				return fmt.Errorf("failed to get OHLC data for %s: %w", ticker, err)
+			}
+
+			// Label candles with unambiguous contract identifier
+			if opts.YearDigits > 1 {
+				label := FuturesTicker(contract, code, y, opts.YearDigits)
+				for i := range data {
+					data[i].Ticker = label
+				}
+			}
+
+			// Skip candles already written from overlapping windows
+			data = After(Dedup(data), *lastDate)
+			if len(data) > 0 {
+				*lastDate = data[len(data)-1].Date
+			}
+			data = FilterVolume(data, opts.MinVolume)
+
+			// Append data to the contract file
+			if err := file.write(data); err != nil {
+				file.abort()
+				return fmt.Errorf("failed to write to file: %w", err)
+			}
+			if opts.CommitPerPeriod && len(data) > 0 {
+				if err := file.checkpoint(); err != nil {
+					file.abort()
+					return err
+				}
+			}
+			result.Rows += len(data)
+			gaps.add(data)
+		}
+	}
+	gaps.report(result)
+
+	if err := file.commit(opts); err != nil {
+		return err
+	}
+
+	if opts.WriteCoverage {
+		return gaps.write(fileName, opts.Writer)
+	}
+	return nil
+}
+
+// notTradedYet reports whether contract trading window begins in the future
+// logging the skipped contract
+func notTradedYet(opts ProcessOptions, ticker string, begin time.Time) bool {
+	if !begin.After(time.Now()) {
+		return false
+	}
+	opts.LogLevel.logf(LogDebug, "Skipping %s: trading window begins %s", ticker, begin.Format("2006-01-02"))
+	return true
+}
@@ -0,0 +1,224 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveContracts answers candles requests of contracts with their candles,
+// other securities get empty pages
+func serveContracts(contracts map[string][]OHLCV) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for ticker, data := range contracts {
+			if strings.Contains(r.URL.Path, "/securities/"+ticker+"/") {
+				servePages(data)(w, r)
+				return
+			}
+		}
+		fmt.Fprint(w, candlesCSV(candlesHeader))
+	}
+}
+
+// readLines returns lines of file without trailing new line
+func readLines(t *testing.T, fileName string) []string {
+	t.Helper()
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestProcessFuturesContractColumn(t *testing.T) {
+	fetcher := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SiH4": minuteCandles("SiH4", moscowTime(2024, 2, 1, 10, 0), 2),
+		"SiM4": minuteCandles("SiM4", moscowTime(2024, 5, 2, 10, 0), 1),
+	}))
+
+	dir := t.TempDir()
+	writer := DefaultWriter()
+	writer.Contract = true
+	opts := ProcessOptions{OutputDir: dir, Writer: writer, Interval: IntervalMinute1, YearDigits: 2}
+
+	if _, err := ProcessFutures(context.Background(), fetcher, opts, 2024, 2025, "Si"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"<CONTRACT>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"SiH24,20240201,10:00:00,100,101,99,100.5,10",
+		"SiH24,20240201,10:01:00,101,102,100,101.5,11",
+		"SiM24,20240502,10:00:00,100,101,99,100.5,10",
+	}
+	got := readLines(t, filepath.Join(dir, "Si.txt"))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunJobKeepsMetaStockLayout(t *testing.T) {
+	fetcher := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SiH4": minuteCandles("SiH4", moscowTime(2024, 2, 1, 10, 0), 1),
+	}))
+
+	dir := t.TempDir()
+	opts := ProcessOptions{Writer: DefaultWriter()}
+	job := JobSpec{Tickers: []string{"Si"}, FromYear: 2024, ToYear: 2024, Interval: IntervalMinute1, Output: dir}
+
+	if _, err := RunJob(context.Background(), fetcher, opts, job); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readLines(t, filepath.Join(dir, "Si.txt"))
+	if got[0] != "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>" {
+		t.Errorf("got header %s", got[0])
+	}
+}
+
+func TestThirdFriday(t *testing.T) {
+	tests := []struct {
+		year, month int
+		want        time.Time
+	}{
+		// Month starting on Friday
+		{2024, 3, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// Month starting on Saturday
+		{2024, 6, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{2023, 12, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{2026, 9, time.Date(2026, 9, 18, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := ThirdFriday(tt.year, tt.month); !got.Equal(tt.want) {
+			t.Errorf("ThirdFriday(%d, %d) = %s, want %s", tt.year, tt.month, got, tt.want)
+		}
+	}
+}
+
+func TestFuturesExpiry(t *testing.T) {
+	ticker, begin, end := FuturesExpiry("Si", "H", 2024)
+	if ticker != "SiH4" {
+		t.Errorf("got ticker %s, want SiH4", ticker)
+	}
+	// Window starts the day before December expiration of the previous year
+	if want := time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC); !begin.Equal(want) {
+		t.Errorf("got begin %s, want %s", begin, want)
+	}
+	if want := time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("got end %s, want %s", end, want)
+	}
+
+	_, begin, end = FuturesExpiry("Si", "M", 2024)
+	if want := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC); !begin.Equal(want) {
+		t.Errorf("got begin %s, want %s", begin, want)
+	}
+	if want := time.Date(2024, 6, 19, 0, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("got end %s, want %s", end, want)
+	}
+
+	if ticker, _, _ := FuturesExpiry("Si", "F", 2024); ticker != "" {
+		t.Errorf("got ticker %s of serial code, want empty", ticker)
+	}
+}
+
+func TestFuturesTickerYearDigits(t *testing.T) {
+	if got := FuturesTicker("Si", "H", 2016, 1); got != "SiH6" {
+		t.Errorf("got %s, want SiH6", got)
+	}
+	if got := FuturesTicker("Si", "H", 2006, 2); got != "SiH06" {
+		t.Errorf("got %s, want SiH06", got)
+	}
+	if got := FuturesTicker("Si", "H", 2016, 0); got != "SiH6" {
+		t.Errorf("got %s of zero digits, want SiH6", got)
+	}
+}
+
+func TestProcessFuturesDecadeCrossing(t *testing.T) {
+	// ISS reuses SiH6 code for 2016 and 2026 contracts, they differ by window only
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		var data []OHLCV
+		if strings.Contains(r.URL.Path, "/securities/SiH6/") {
+			switch from := r.URL.Query().Get("from"); {
+			case strings.HasPrefix(from, "2015-12"):
+				data = minuteCandles("SiH6", moscowTime(2016, 2, 1, 10, 0), 1)
+			case strings.HasPrefix(from, "2025-12"):
+				data = minuteCandles("SiH6", moscowTime(2026, 2, 2, 10, 0), 1)
+			}
+		}
+		servePages(data)(w, r)
+	})
+
+	dir := t.TempDir()
+	writer := DefaultWriter()
+	writer.Contract = true
+	opts := ProcessOptions{OutputDir: dir, Writer: writer, Interval: IntervalMinute1, YearDigits: 2, RequestDelay: -1}
+
+	if _, err := ProcessFutures(context.Background(), fetcher, opts, 2016, 2027, "Si"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"<CONTRACT>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"SiH16,20160201,10:00:00,100,101,99,100.5,10",
+		"SiH26,20260202,10:00:00,100,101,99,100.5,10",
+	}
+	got := readLines(t, filepath.Join(dir, "Si.txt"))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExpandContracts(t *testing.T) {
+	got := ExpandContracts("Si", 2025, 2027, false)
+	want := []string{"SiH5", "SiM5", "SiU5", "SiZ5", "SiH6", "SiM6", "SiU6", "SiZ6"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	serial := ExpandContracts("Si", 2026, 2027, true)
+	if len(serial) != 12 || serial[0] != "SiF6" || serial[11] != "SiZ6" {
+		t.Errorf("got serial contracts %v", serial)
+	}
+}
+
+func TestProcessFuturesSplitByYear(t *testing.T) {
+	fetcher := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SiZ3": minuteCandles("SiZ3", moscowTime(2023, 11, 1, 10, 0), 1),
+		"SiH4": minuteCandles("SiH4", moscowTime(2024, 2, 1, 10, 0), 2),
+	}))
+
+	dir := t.TempDir()
+	writer := DefaultWriter()
+	writer.Contract = true
+	opts := ProcessOptions{OutputDir: dir, Writer: writer, Interval: IntervalMinute1, SplitByYear: true, RequestDelay: -1}
+
+	if _, err := ProcessFutures(context.Background(), fetcher, opts, 2023, 2025, "Si"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"Si_2023.txt": {
+			"<CONTRACT>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+			"SiZ3,20231101,10:00:00,100,101,99,100.5,10",
+		},
+		"Si_2024.txt": {
+			"<CONTRACT>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+			"SiH4,20240201,10:00:00,100,101,99,100.5,10",
+			"SiH4,20240201,10:01:00,101,102,100,101.5,11",
+		},
+	}
+	for name, lines := range want {
+		got := readLines(t, filepath.Join(dir, name))
+		if strings.Join(got, "\n") != strings.Join(lines, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, strings.Join(got, "\n"), strings.Join(lines, "\n"))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Si.txt")); !os.IsNotExist(err) {
+		t.Errorf("single root file is written: %v", err)
+	}
+}
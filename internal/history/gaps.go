@@ -0,0 +1,87 @@
+package history
+
+import "time"
+
+// Gap is a range of absent bars inside candles series
+type Gap struct {
+	// Start and End are timestamps of the first and the last missing bars
+	Start time.Time
+	End   time.Time
+	// Missing is the number of absent bars
+	Missing int
+}
+
+// FindGaps returns ranges of absent bars in candles sorted by Date.
+// Intraday bars are expected every interval within a session, breaks between
+// sessions are not gaps. Daily bars are expected on weekdays, weekly, monthly
+// and quarterly bars every period.
+func FindGaps(data []OHLCV, interval int) []Gap {
+	return findGaps(data, interval, weekday)
+}
+
+// FindGapsCalendar is FindGaps expecting daily bars on trading dates only,
+// e.g. returned by InferTradingDates, so exchange holidays are not gaps
+func FindGapsCalendar(data []OHLCV, interval int, tradingDates []time.Time) []Gap {
+	dates := make(map[string]bool, len(tradingDates))
+	for _, date := range tradingDates {
+		dates[date.Format("2006-01-02")] = true
+	}
+	return findGaps(data, interval, func(date time.Time) bool {
+		return dates[date.Format("2006-01-02")]
+	})
+}
+
+// findGaps returns gaps in candles with daily bars expected on trading days
+func findGaps(data []OHLCV, interval int, tradingDay func(time.Time) bool) []Gap {
+	var gaps []Gap
+	for i := 1; i < len(data); i++ {
+		if gap, ok := findGap(data[i-1].Date, data[i].Date, interval, tradingDay); ok {
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps
+}
+
+// weekday reports whether date is a weekday, the default trading day
+func weekday(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// findGap returns gap between adjacent bars dated prev and next
+func findGap(prev, next time.Time, interval int, tradingDay func(time.Time) bool) (Gap, bool) {
+	if step, ok := intradayDuration(interval); ok {
+		if !sameDay(OHLCV{Date: prev}, OHLCV{Date: next}) {
+			return Gap{}, false
+		}
+		missing := int(next.Sub(prev)/step) - 1
+		if missing < 1 {
+			return Gap{}, false
+		}
+		return Gap{Start: prev.Add(step), End: next.Add(-step), Missing: missing}, true
+	}
+
+	var expected []time.Time
+	for date := nextPeriod(prev, interval); date.Before(next); date = nextPeriod(date, interval) {
+		if interval == IntervalDay && !tradingDay(date) {
+			continue
+		}
+		expected = append(expected, date)
+	}
+	if len(expected) == 0 {
+		return Gap{}, false
+	}
+	return Gap{Start: expected[0], End: expected[len(expected)-1], Missing: len(expected)}, true
+}
+
+// nextPeriod returns start of the bar following date for non intraday intervals
+func nextPeriod(date time.Time, interval int) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return date.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return date.AddDate(0, 1, 0)
+	case IntervalQuarter:
+		return date.AddDate(0, 3, 0)
+	}
+	return date.AddDate(0, 0, 1)
+}
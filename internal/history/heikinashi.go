@@ -0,0 +1,25 @@
+package history
+
+import "math"
+
+// HeikinAshi returns Heikin-Ashi candles of candles sorted by Date:
+// close is the average of open, high, low and close, open is the midpoint of
+// the previous Heikin-Ashi open and close, seeded with the midpoint of the
+// first candle open and close, high and low include the new open and close.
+// Other fields are copied.
+func HeikinAshi(candles []OHLCV) []OHLCV {
+	result := make([]OHLCV, len(candles))
+	for i, ohlc := range candles {
+		ha := ohlc
+		ha.Close = (ohlc.Open + ohlc.High + ohlc.Low + ohlc.Close) / 4
+		if i == 0 {
+			ha.Open = (ohlc.Open + ohlc.Close) / 2
+		} else {
+			ha.Open = (result[i-1].Open + result[i-1].Close) / 2
+		}
+		ha.High = math.Max(ohlc.High, math.Max(ha.Open, ha.Close))
+		ha.Low = math.Min(ohlc.Low, math.Min(ha.Open, ha.Close))
+		result[i] = ha
+	}
+	return result
+}
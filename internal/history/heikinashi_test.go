@@ -0,0 +1,45 @@
+package history
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHeikinAshi(t *testing.T) {
+	date := moscowTime(2024, 1, 10, 10, 0)
+	candles := []OHLCV{
+		{Ticker: "SBER", Date: date, Open: 10, High: 12, Low: 9, Close: 11, Volume: 5},
+		{Ticker: "SBER", Date: date, Open: 11, High: 11.5, Low: 8, Close: 8.5, Volume: 6},
+		{Ticker: "SBER", Date: date, Open: 8, High: 9, Low: 7.5, Close: 9, Volume: 7},
+	}
+
+	want := []OHLCV{
+		// First bar open is seeded with midpoint of its open and close
+		{Open: (10 + 11) / 2.0, High: 12, Low: 9, Close: (10 + 12 + 9 + 11) / 4.0},
+		{Open: (10.5 + 10.5) / 2, High: 11.5, Low: 8, Close: (11 + 11.5 + 8 + 8.5) / 4},
+		// High includes the Heikin-Ashi open above the candle high
+		{Open: (10.5 + 9.75) / 2, High: 10.125, Low: 7.5, Close: (8 + 9 + 7.5 + 9) / 4},
+	}
+
+	got := HeikinAshi(candles)
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for i := range want {
+		g, w := got[i], want[i]
+		if !near(g.Open, w.Open) || !near(g.High, w.High) || !near(g.Low, w.Low) || !near(g.Close, w.Close) {
+			t.Errorf("candle %d: got %v/%v/%v/%v, want %v/%v/%v/%v", i,
+				g.Open, g.High, g.Low, g.Close, w.Open, w.High, w.Low, w.Close)
+		}
+		if g.Volume != candles[i].Volume || g.Ticker != "SBER" {
+			t.Errorf("candle %d: other fields aren't copied", i)
+		}
+	}
+	if candles[0].Open != 10 {
+		t.Error("input candles were modified")
+	}
+	if got := HeikinAshi(nil); len(got) != 0 {
+		t.Errorf("got %d candles of nil input", len(got))
+	}
+}
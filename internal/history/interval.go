@@ -0,0 +1,65 @@
+package history
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Candle intervals supported by ISS candles endpoint
+const (
+	IntervalMinute1  = 1
+	IntervalMinute10 = 10
+	IntervalHour     = 60
+	IntervalDay      = 24
+	IntervalWeek     = 7
+	IntervalMonth    = 31
+	IntervalQuarter  = 4
+)
+
+// ErrInvalidInterval is returned for intervals not supported by ISS
+var ErrInvalidInterval = errors.New("invalid candle interval")
+
+// ValidateInterval returns ErrInvalidInterval when interval is not supported by ISS
+func ValidateInterval(interval int) error {
+	switch interval {
+	case IntervalMinute1, IntervalMinute10, IntervalHour,
+		IntervalDay, IntervalWeek, IntervalMonth, IntervalQuarter:
+		return nil
+	}
+	return errors.Wrapf(ErrInvalidInterval, "interval %d", interval)
+}
+
+// intradayDuration returns bar duration of intraday intervals, false otherwise
+func intradayDuration(interval int) (time.Duration, bool) {
+	switch interval {
+	case IntervalMinute1:
+		return time.Minute, true
+	case IntervalMinute10:
+		return 10 * time.Minute, true
+	case IntervalHour:
+		return time.Hour, true
+	}
+	return 0, false
+}
+
+// intervalSuffixes are short interval names used in file names
+var intervalSuffixes = map[int]string{
+	IntervalMinute1:  "M1",
+	IntervalMinute10: "M10",
+	IntervalHour:     "H1",
+	IntervalDay:      "D",
+	IntervalWeek:     "W",
+	IntervalMonth:    "MN",
+	IntervalQuarter:  "Q",
+}
+
+// IntervalSuffix returns short name of interval, e.g. D for daily candles,
+// or the interval number for unsupported intervals
+func IntervalSuffix(interval int) string {
+	if suffix, ok := intervalSuffixes[interval]; ok {
+		return suffix
+	}
+	return strconv.Itoa(interval)
+}
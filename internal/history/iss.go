@@ -0,0 +1,65 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// issTable is a data block of ISS json response
+type issTable struct {
+	Columns []string `json:"columns"`
+	Data    [][]any  `json:"data"`
+}
+
+// getTables requests ISS json url and returns its data blocks by name
+func (f *Fetcher) getTables(ctx context.Context, ticker, url string) (map[string]issTable, error) {
+	resp, err := f.get(ctx, ticker, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tables map[string]issTable
+	if err := json.NewDecoder(resp.Body).Decode(&tables); err != nil {
+		return nil, errors.Wrap(err, "decode iss response")
+	}
+	return tables, nil
+}
+
+// rows returns table rows as maps of column name to value
+func (t issTable) rows() []map[string]any {
+	rows := make([]map[string]any, 0, len(t.Data))
+	for _, data := range t.Data {
+		row := make(map[string]any, len(t.Columns))
+		for i, column := range t.Columns {
+			if i < len(data) {
+				row[column] = data[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// cellString returns text of ISS cell, empty for null
+func cellString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// cellInt returns integer of numeric ISS cell, zero for null and text
+func cellInt(value any) int {
+	if v, ok := value.(float64); ok {
+		return int(v)
+	}
+	return 0
+}
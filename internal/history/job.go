@@ -0,0 +1,115 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Job kinds selecting the processor of job instruments
+const (
+	// JobFutures downloads quarterly contracts of futures roots with ProcessFutures
+	JobFutures = "futures"
+	// JobShares downloads instruments by their tickers with ProcessShares,
+	// e.g. shares or currency pairs
+	JobShares = "shares"
+)
+
+// JobSpec describes a download job: instruments, their ISS coordinates,
+// year range, candles interval and output directory. Empty coordinates are
+// resolved by the processor, empty board is the first of BoardChain.
+type JobSpec struct {
+	Name string `json:"name"`
+	// Kind is JobFutures or JobShares, when empty it is JobFutures for empty
+	// or futures engine and JobShares otherwise
+	Kind     string   `json:"kind"`
+	Engine   string   `json:"engine"`
+	Market   string   `json:"market"`
+	Board    string   `json:"board"`
+	Tickers  []string `json:"tickers"`
+	FromYear int      `json:"from_year"`
+	// ToYear is the last year to download, inclusive
+	ToYear   int    `json:"to_year"`
+	Interval int    `json:"interval"`
+	Output   string `json:"output"`
+}
+
+// jobsConfig is the layout of jobs config file
+type jobsConfig struct {
+	Jobs []JobSpec `json:"jobs"`
+}
+
+// LoadJobs reads JSON config file with a list of jobs:
+//
+//	{"jobs": [{"name": "shares", "engine": "stock", "market": "shares", "board": "TQBR",
+//	  "tickers": ["SBER", "GAZP"], "from_year": 2020, "to_year": 2024, "interval": 24,
+//	  "output": "data/shares"}]}
+func LoadJobs(fileName string) ([]JobSpec, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "read jobs config")
+	}
+
+	var config jobsConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, errors.Wrap(err, "parse jobs config")
+	}
+
+	for i, job := range config.Jobs {
+		if len(job.Tickers) == 0 {
+			return nil, errors.Errorf("job %d %q has no tickers", i, job.Name)
+		}
+		if err := ValidateInterval(job.Interval); err != nil {
+			return nil, errors.Wrapf(err, "job %d %q", i, job.Name)
+		}
+		if err := ValidateJobKind(job.Kind); err != nil {
+			return nil, errors.Wrapf(err, "job %d %q", i, job.Name)
+		}
+	}
+
+	return config.Jobs, nil
+}
+
+// ValidateJobKind returns error unless kind is JobFutures, JobShares or empty
+func ValidateJobKind(kind string) error {
+	switch kind {
+	case "", JobFutures, JobShares:
+		return nil
+	}
+	return errors.Errorf("unknown job kind %q, want %s or %s", kind, JobFutures, JobShares)
+}
+
+// JobKind returns job kind inferring it from engine when Kind isn't set
+func (job JobSpec) JobKind() string {
+	if job.Kind != "" {
+		return job.Kind
+	}
+	if job.Engine == "" || job.Engine == FuturesEngine {
+		return JobFutures
+	}
+	return JobShares
+}
+
+// RunJob downloads job instruments with ProcessFutures or ProcessShares by
+// job kind. Job coordinates, interval and output override opts.
+func RunJob(ctx context.Context, fetcher *Fetcher, opts ProcessOptions, job JobSpec) (*Report, error) {
+	if err := ValidateJobKind(job.Kind); err != nil {
+		return nil, err
+	}
+
+	opts.Engine = job.Engine
+	opts.Market = job.Market
+	opts.Board = job.Board
+	opts.Interval = job.Interval
+	if job.Output != "" {
+		opts.OutputDir = job.Output
+	}
+
+	if job.JobKind() == JobFutures {
+		// ProcessFutures range excludes the last year
+		return ProcessFutures(ctx, fetcher, opts, job.FromYear, job.ToYear+1, job.Tickers...)
+	}
+	return ProcessShares(ctx, fetcher, opts, job.FromYear, job.ToYear, job.Tickers...)
+}
@@ -0,0 +1,59 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// requestedPaths runs job and returns paths of its ISS requests
+func requestedPaths(t *testing.T, job JobSpec) []string {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		servePages(nil)(w, r)
+	})
+
+	job.FromYear, job.ToYear, job.Interval, job.Output = 2024, 2024, IntervalDay, t.TempDir()
+	if _, err := RunJob(context.Background(), fetcher, ProcessOptions{Writer: DefaultWriter(), RequestDelay: -1}, job); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no requests are made")
+	}
+	return paths
+}
+
+func TestRunJobResolvesCoordinates(t *testing.T) {
+	tests := []struct {
+		name string
+		job  JobSpec
+		want string
+	}{
+		{"futures by default", JobSpec{Tickers: []string{"Si"}},
+			"/iss/engines/futures/markets/forts/boards/RFUD/securities/SiH4/candles.csv"},
+		{"shares kind", JobSpec{Kind: JobShares, Tickers: []string{"SBER"}},
+			"/iss/engines/stock/markets/shares/boards/TQBR/securities/SBER/candles.csv"},
+		{"stock engine", JobSpec{Engine: SharesEngine, Market: SharesMarket, Tickers: []string{"SBER"}},
+			"/iss/engines/stock/markets/shares/boards/TQBR/securities/SBER/candles.csv"},
+		{"currency engine", JobSpec{Engine: CurrencyEngine, Market: CurrencyMarket, Tickers: []string{"USD000UTSTOM"}},
+			"/iss/engines/currency/markets/selt/boards/CETS/securities/USD000UTSTOM/candles.csv"},
+	}
+	for _, tt := range tests {
+		if got := requestedPaths(t, tt.job)[0]; got != tt.want {
+			t.Errorf("%s: requested %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunJobUnknownKind(t *testing.T) {
+	job := JobSpec{Kind: "bonds", Tickers: []string{"SU26238RMFS4"}}
+	if _, err := RunJob(context.Background(), &Fetcher{}, ProcessOptions{}, job); err == nil {
+		t.Error("expected error of unknown kind")
+	}
+}
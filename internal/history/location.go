@@ -0,0 +1,20 @@
+package history
+
+import (
+	"time"
+	// embedded time zone database keeps historical Moscow offsets, e.g.
+	// MSK+4 of 2011-2014, on hosts without one
+	_ "time/tzdata"
+)
+
+// Moscow is the exchange time zone ISS timestamps are given in.
+// Fixed MSK offset is used when time zone database is unavailable.
+var Moscow = loadMoscow()
+
+func loadMoscow() *time.Location {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return time.FixedZone("MSK", 3*60*60)
+	}
+	return loc
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMoscowOffset(t *testing.T) {
+	tests := []struct {
+		date  time.Time
+		hours int
+	}{
+		{time.Date(2010, 1, 15, 12, 0, 0, 0, time.UTC), 3},
+		// Summer time was last observed in 2010
+		{time.Date(2010, 7, 15, 12, 0, 0, 0, time.UTC), 4},
+		// MSK+4 all year round from March 2011 till October 2014
+		{time.Date(2011, 7, 15, 12, 0, 0, 0, time.UTC), 4},
+		{time.Date(2012, 1, 15, 12, 0, 0, 0, time.UTC), 4},
+		{time.Date(2014, 10, 25, 12, 0, 0, 0, time.UTC), 4},
+		{time.Date(2014, 10, 26, 12, 0, 0, 0, time.UTC), 3},
+		{time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC), 3},
+	}
+	for _, test := range tests {
+		if _, offset := test.date.In(Moscow).Zone(); offset != test.hours*60*60 {
+			t.Errorf("%s: got offset %ds, want UTC+%d", test.date.Format("2006-01-02"), offset, test.hours)
+		}
+	}
+}
+
+func TestWriterDateTimeAcrossOffsets(t *testing.T) {
+	// ISS gives Moscow wall clock whatever offset was in force
+	walls := []string{"2010-01-15 10:00:00", "2010-07-15 10:00:00", "2012-01-16 10:00:00", "2024-07-15 10:00:00"}
+	rows := make([]string, 0, len(walls))
+	for _, wall := range walls {
+		rows = append(rows, fmt.Sprintf("1;1;1;1;0;1;%s;%s", wall, strings.Replace(wall, ":00:00", ":00:59", 1)))
+	}
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader, rows...))
+	})
+	from := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", from, from.AddDate(15, 0, 0), IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(walls) {
+		t.Fatalf("got %d candles, want %d", len(data), len(walls))
+	}
+
+	// 10:00 MSK is 07:00 UTC at MSK+3 and 06:00 UTC at MSK+4
+	wantUTC := []int{7, 6, 6, 7}
+	writer := DefaultWriter()
+	utcWriter := DefaultWriter()
+	utcWriter.Location = time.UTC
+	for i, ohlc := range data {
+		if hour := ohlc.Date.UTC().Hour(); hour != wantUTC[i] {
+			t.Errorf("%s: got %02d:00 UTC, want %02d:00", walls[i], hour, wantUTC[i])
+		}
+
+		wall, _ := time.Parse("2006-01-02 15:04:05", walls[i])
+		if got, want := writer.Row(ohlc), wall.Format("20060102,15:04:05,"); !strings.HasPrefix(got, want) {
+			t.Errorf("got row %q, want DATE and TIME %q", got, want)
+		}
+		if got, want := utcWriter.Row(ohlc), wall.Format("20060102,")+fmt.Sprintf("%02d:00:00,", wantUTC[i]); !strings.HasPrefix(got, want) {
+			t.Errorf("got UTC row %q, want DATE and TIME %q", got, want)
+		}
+	}
+
+	// Written DATE and TIME are read back into the same instant
+	fileName := filepath.Join(t.TempDir(), "SBER.txt")
+	if err := os.WriteFile(fileName, []byte(writer.HeaderLine()+writer.Row(data[2])), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if last, ok := LastTimestamp(fileName, writer); !ok || !last.Equal(data[2].Date) {
+		t.Errorf("got last timestamp %s, want %s", last, data[2].Date)
+	}
+}
+
+func TestParseUTCKeepsWallClock(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Query().Get("from"), "2023-03") {
+			fmt.Fprint(w, candlesCSV(candlesHeader))
+			return
+		}
+		fmt.Fprint(w, candlesCSV(candlesHeader, "1;1;1;1;0;1;2023-03-01 10:00:00;2023-03-01 10:00:59"))
+	})
+	fetcher.ParseUTC = true
+
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not shifted by the Moscow offset
+	want := []string{"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>", "20230301,10:00:00,1,1,1,1,1"}
+	if got := readLines(t, filepath.Join(dir, "SBER.txt")); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
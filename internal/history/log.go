@@ -0,0 +1,34 @@
+package history
+
+import "fmt"
+
+// LogLevel controls verbosity of lines printed to stdout while downloading
+type LogLevel int
+
+const (
+	// LogSilent prints nothing
+	LogSilent LogLevel = -1
+	// LogInfo prints per ticker progress and summaries, it is the default
+	LogInfo LogLevel = 0
+	// LogDebug adds requested URLs and per period details
+	LogDebug LogLevel = 1
+)
+
+// Verbosity returns LogDebug for verbose, LogSilent for quiet and LogInfo
+// otherwise, e.g. for -v and -q command line flags
+func Verbosity(verbose, quiet bool) LogLevel {
+	switch {
+	case quiet:
+		return LogSilent
+	case verbose:
+		return LogDebug
+	}
+	return LogInfo
+}
+
+// logf prints formatted line when level is enabled by l
+func (l LogLevel) logf(level LogLevel, format string, args ...any) {
+	if l >= level {
+		fmt.Printf(format+"\n", args...)
+	}
+}
@@ -0,0 +1,89 @@
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStreamClosed is returned by writes into closed NDJSONStream
+var ErrStreamClosed = errors.New("NDJSON stream is closed")
+
+// NDJSONStream is a Storer writing candles of many tickers into a single
+// newline delimited JSON stream, one candle object with its ticker per line.
+// Batches written concurrently are fanned in through a channel to a single
+// writer goroutine, so lines of different tickers never interleave.
+type NDJSONStream struct {
+	mu      sync.Mutex
+	closed  bool
+	batches chan []OHLCV
+	done    chan error
+	err     error
+}
+
+// NewNDJSONStream starts NDJSON stream writing into w, e.g. a file or os.Stdout.
+// Close must be called to flush pending batches.
+func NewNDJSONStream(w io.Writer) *NDJSONStream {
+	s := &NDJSONStream{
+		batches: make(chan []OHLCV, 16),
+		done:    make(chan error, 1),
+	}
+
+	go func() {
+		var err error
+		encoder := json.NewEncoder(w)
+		for data := range s.batches {
+			if err != nil {
+				continue
+			}
+			for _, ohlc := range data {
+				if err = encoder.Encode(ohlc); err != nil {
+					break
+				}
+			}
+		}
+		s.done <- err
+	}()
+
+	return s
+}
+
+// Write queues ticker candles batch for writing, it is safe for concurrent use.
+// Candles keep their own ticker, e.g. a futures contract, ticker is set on
+// candles without one.
+func (s *NDJSONStream) Write(ticker string, data []OHLCV) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	batch := make([]OHLCV, len(data))
+	for i, ohlc := range data {
+		if ohlc.Ticker == "" {
+			ohlc.Ticker = ticker
+		}
+		batch[i] = ohlc
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	s.batches <- batch
+	return nil
+}
+
+// Close waits until all queued batches are written and returns the first
+// write error, closing the stream again returns the same error
+func (s *NDJSONStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.batches)
+		s.err = <-s.done
+	}
+	return s.err
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNDJSONStreamTwoTickers(t *testing.T) {
+	fetcher := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SBER": minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 2),
+		"GAZP": minuteCandles("GAZP", moscowTime(2023, 3, 1, 10, 0), 3),
+	}))
+	var buf bytes.Buffer
+	stream := NewNDJSONStream(&buf)
+	opts := ProcessOptions{Interval: IntervalMinute1, RequestDelay: -1, Concurrency: 2, Storer: stream}
+
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER", "GAZP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make(map[string]int)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var ohlc OHLCV
+		if err := json.Unmarshal(scanner.Bytes(), &ohlc); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		rows[ohlc.Ticker]++
+	}
+	// The same candles are served for every month of the year
+	if len(rows) != 2 || rows["SBER"] == 0 || rows["GAZP"] == 0 || rows["SBER"]*3 != rows["GAZP"]*2 {
+		t.Errorf("got rows %v", rows)
+	}
+}
+
+func TestNDJSONStreamKeepsContractTicker(t *testing.T) {
+	var buf bytes.Buffer
+	stream := NewNDJSONStream(&buf)
+	data := minuteCandles("SiH4", moscowTime(2024, 2, 1, 10, 0), 1)
+	data = append(data, OHLCV{Date: moscowTime(2024, 2, 1, 10, 1)})
+
+	if err := stream.Write("Si", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := json.NewDecoder(&buf)
+	for _, want := range []string{"SiH4", "Si"} {
+		var ohlc OHLCV
+		if err := decoder.Decode(&ohlc); err != nil {
+			t.Fatal(err)
+		}
+		if ohlc.Ticker != want {
+			t.Errorf("got ticker %s, want %s", ohlc.Ticker, want)
+		}
+	}
+}
+
+func TestNDJSONStreamWriteAfterClose(t *testing.T) {
+	stream := NewNDJSONStream(&bytes.Buffer{})
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := stream.Write("SBER", minuteCandles("SBER", moscowTime(2024, 2, 1, 10, 0), 1))
+	if !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("got %v, want ErrStreamClosed", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package history
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// Cursor is pagination metadata ISS reports along with a page
+type Cursor struct {
+	// Index is the first row of the page
+	Index int
+	// Total is the number of rows of all pages
+	Total int
+	// PageSize is the maximum number of rows in a page
+	PageSize int
+}
+
+// Page is a single page of candles
+type Page struct {
+	Candles []OHLCV
+	// Cursor is nil when ISS doesn't report it for the request
+	Cursor *Cursor
+}
+
+// FetchPage reads a single page of ticker candles for the date range
+// beginning at start row, e.g. to fetch pages in parallel once Cursor total
+// is known. Candles are returned as ISS sends them, WholeSessionsOnly and
+// Limit are not applied.
+func (f *Fetcher) FetchPage(
+	ctx context.Context, engine, market, board, ticker string, startDate, endDate time.Time, interval, start int,
+) (Page, error) {
+	if err := ValidateInterval(interval); err != nil {
+		return Page{}, err
+	}
+	if err := ValidateDateRange(startDate, endDate); err != nil {
+		return Page{}, err
+	}
+
+	req := candlesRequest{
+		engine:    engine,
+		market:    market,
+		board:     board,
+		ticker:    ticker,
+		startDate: startDate,
+		endDate:   endDate,
+		interval:  interval,
+	}
+	schemaKey := fmt.Sprintf("%s/%s/candles", engine, market)
+
+	var page Page
+	_, cursor, err := f.readPage(ctx, schemaKey, req, start, f.location(), func(ohlc OHLCV) error {
+		page.Candles = append(page.Candles, ohlc)
+		return nil
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	page.Cursor = cursor
+	return page, nil
+}
+
+// parallelPages reads the first page of request and, when ISS reports its
+// cursor, the following pages ParallelPages at a time, passing candles to fn
+// in page order. Without cursor the offset sequential reading has to continue
+// from is returned, zero when the first page is the last one.
+func (f *Fetcher) parallelPages(
+	ctx context.Context, schemaKey string, req candlesRequest, location *time.Location, fn func(OHLCV) error,
+) (int, error) {
+	var first []OHLCV
+	batchSize, cursor, err := f.readPage(ctx, schemaKey, req, 0, location, func(ohlc OHLCV) error {
+		first = append(first, ohlc)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if cursor == nil || cursor.PageSize <= 0 {
+		for _, ohlc := range first {
+			if err := fn(ohlc); err != nil {
+				return 0, err
+			}
+		}
+		if batchSize < pageSize {
+			return 0, nil
+		}
+		return batchSize, nil
+	}
+
+	var offsets []int
+	for start := cursor.PageSize; start < cursor.Total; start += cursor.PageSize {
+		offsets = append(offsets, start)
+	}
+	pages := make([][]OHLCV, len(offsets))
+
+	gr, grCtx := errgroup.WithContext(ctx)
+	gr.SetLimit(f.ParallelPages)
+	for i, start := range offsets {
+		gr.Go(func() error {
+			_, _, err := f.readPage(grCtx, schemaKey, req, start, location, func(ohlc OHLCV) error {
+				pages[i] = append(pages[i], ohlc)
+				return nil
+			})
+			return err
+		})
+	}
+	if err := gr.Wait(); err != nil {
+		return 0, err
+	}
+
+	for _, page := range append([][]OHLCV{first}, pages...) {
+		for _, ohlc := range page {
+			if err := fn(ohlc); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+// blockName returns name of ISS block beginning with row, e.g. candles.cursor
+// or dataversion. Block name row is a single field starting with a letter
+// and consisting of letters, digits, dots and underscores.
+func blockName(row []string) (string, bool) {
+	if len(row) != 1 || row[0] == "" {
+		return "", false
+	}
+	for i, r := range row[0] {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if i == 0 && !letter {
+			return "", false
+		}
+		if !letter && !(r >= '0' && r <= '9') && r != '.' && r != '_' {
+			return "", false
+		}
+	}
+	return row[0], true
+}
+
+// readCursor reads cursor block columns and values following its name
+func readCursor(reader *csv.Reader) (*Cursor, error) {
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read cursor columns")
+	}
+	values, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read cursor values")
+	}
+
+	var cursor Cursor
+	for i, column := range columns {
+		if i >= len(values) {
+			break
+		}
+		value, err := strconv.Atoi(values[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse cursor %s", column)
+		}
+		switch strings.ToUpper(column) {
+		case "INDEX":
+			cursor.Index = value
+		case "TOTAL":
+			cursor.Total = value
+		case "PAGESIZE":
+			cursor.PageSize = value
+		}
+	}
+	return &cursor, nil
+}
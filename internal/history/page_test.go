@@ -0,0 +1,126 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// multiBlockPage is an ISS candles.csv response with cursor and data version
+// blocks following candles
+const multiBlockPage = `candles
+open;close;high;low;value;volume;begin;end
+1;2;3;0.5;0;10;2024-01-10 10:00:00;2024-01-10 10:00:59
+2;3;4;1.5;0;20;2024-01-10 10:01:00;2024-01-10 10:01:59
+
+candles.cursor
+INDEX;TOTAL;PAGESIZE
+0;2;500
+
+dataversion
+data_version;seqnum
+7;20240110
+`
+
+func TestReadPageStopsAtNamedBlock(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, multiBlockPage)
+	})
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Volume != 20 {
+		t.Errorf("got %d candles %v, want 2", len(got), got)
+	}
+
+	page, err := fetcher.FetchPage(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Cursor == nil || page.Cursor.Total != 2 || page.Cursor.PageSize != 500 {
+		t.Errorf("got cursor %+v", page.Cursor)
+	}
+}
+
+func TestReadPageMalformedRow(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader,
+			"1;2;3;0.5;0;10;2024-01-10 10:00:00;2024-01-10 10:00:59",
+			"2;3;4;1.5;0;20;2024-01-10 10:01:00",
+		))
+	})
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	_, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("got %v, want FetchError", err)
+	}
+	if fetchErr.Row != 2 {
+		t.Errorf("got row %d, want 2", fetchErr.Row)
+	}
+}
+
+func TestBlockName(t *testing.T) {
+	for _, tt := range []struct {
+		row  []string
+		want bool
+	}{
+		{[]string{"candles.cursor"}, true},
+		{[]string{"dataversion"}, true},
+		{[]string{"100.5"}, false},
+		{[]string{""}, false},
+		{[]string{"candles", "cursor"}, false},
+	} {
+		if _, got := blockName(tt.row); got != tt.want {
+			t.Errorf("blockName(%q) = %v, want %v", tt.row, got, tt.want)
+		}
+	}
+}
+
+// serveCursorPages serves data pages like servePages followed by ISS cursor
+func serveCursorPages(data []OHLCV) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		servePages(data)(w, r)
+		fmt.Fprintf(w, "\ncandles.cursor\nINDEX;TOTAL;PAGESIZE\n%d;%d;%d\n", start, len(data), pageSize)
+	}
+}
+
+func TestParallelPagesMatchSequential(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3*pageSize+pageSize/2)
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	sequential, err := newTestFetcher(serveCursorPages(data)).Fetch(
+		context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	fetcher := newTestFetcher(countRequests(&requests, serveCursorPages(data)))
+	fetcher.ParallelPages = 3
+	parallel, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parallel) != len(data) {
+		t.Fatalf("got %d candles, want %d", len(parallel), len(data))
+	}
+	if !reflect.DeepEqual(parallel, sequential) {
+		t.Error("parallel pages differ from sequential ones")
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("got %d requests, want 4", got)
+	}
+}
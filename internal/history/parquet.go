@@ -0,0 +1,302 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// parquetMagic begins and ends Parquet files
+const parquetMagic = "PAR1"
+
+// Parquet physical and converted types, encodings and page types
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain    = 0
+	parquetRLE      = 3
+	parquetDataPage = 0
+	parquetRequired = 0
+)
+
+// parquetColumn describes a column of written candles
+type parquetColumn struct {
+	name string
+	typ  int32
+	// converted is the converted type, negative when there is none
+	converted int32
+	encode    func(buf *bytes.Buffer, ohlc OHLCV)
+}
+
+// parquetColumns are columns WriteParquet writes
+var parquetColumns = []parquetColumn{
+	{"ticker", parquetByteArray, parquetUTF8, func(buf *bytes.Buffer, ohlc OHLCV) {
+		binary.Write(buf, binary.LittleEndian, uint32(len(ohlc.Ticker)))
+		buf.WriteString(ohlc.Ticker)
+	}},
+	{"date", parquetInt64, parquetTimestampMillis, func(buf *bytes.Buffer, ohlc OHLCV) {
+		binary.Write(buf, binary.LittleEndian, ohlc.Date.UnixMilli())
+	}},
+	{"open", parquetDouble, -1, func(buf *bytes.Buffer, ohlc OHLCV) { writeDouble(buf, ohlc.Open) }},
+	{"high", parquetDouble, -1, func(buf *bytes.Buffer, ohlc OHLCV) { writeDouble(buf, ohlc.High) }},
+	{"low", parquetDouble, -1, func(buf *bytes.Buffer, ohlc OHLCV) { writeDouble(buf, ohlc.Low) }},
+	{"close", parquetDouble, -1, func(buf *bytes.Buffer, ohlc OHLCV) { writeDouble(buf, ohlc.Close) }},
+	{"volume", parquetInt64, -1, func(buf *bytes.Buffer, ohlc OHLCV) {
+		binary.Write(buf, binary.LittleEndian, ohlc.Volume)
+	}},
+	{"value", parquetDouble, -1, func(buf *bytes.Buffer, ohlc OHLCV) { writeDouble(buf, ohlc.Value) }},
+	{"openoi", parquetInt64, -1, func(buf *bytes.Buffer, ohlc OHLCV) {
+		binary.Write(buf, binary.LittleEndian, ohlc.OpenOI)
+	}},
+	{"closeoi", parquetInt64, -1, func(buf *bytes.Buffer, ohlc OHLCV) {
+		binary.Write(buf, binary.LittleEndian, ohlc.CloseOI)
+	}},
+}
+
+func writeDouble(buf *bytes.Buffer, value float64) {
+	binary.Write(buf, binary.LittleEndian, math.Float64bits(value))
+}
+
+// WriteParquet writes candles into Parquet file with typed columns: ticker
+// string, date timestamp in milliseconds, open, high, low, close and value
+// doubles, volume and open interest int64. All candles are written into
+// a single row group of uncompressed PLAIN encoded pages.
+func WriteParquet(path string, data []OHLCV) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "create parquet file")
+	}
+
+	out := bufio.NewWriter(file)
+	out.WriteString(parquetMagic)
+	offset := int64(len(parquetMagic))
+
+	chunks := make([]parquetChunk, 0, len(parquetColumns))
+	for _, column := range parquetColumns {
+		var values bytes.Buffer
+		for _, ohlc := range data {
+			column.encode(&values, ohlc)
+		}
+		header := parquetPageHeader(len(data), values.Len())
+
+		out.Write(header)
+		out.Write(values.Bytes())
+
+		size := int64(len(header) + values.Len())
+		chunks = append(chunks, parquetChunk{column: column, offset: offset, size: size})
+		offset += size
+	}
+
+	footer := parquetFooter(chunks, int64(len(data)))
+	out.Write(footer)
+	binary.Write(out, binary.LittleEndian, uint32(len(footer)))
+	out.WriteString(parquetMagic)
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "write parquet file")
+	}
+	return errors.Wrap(file.Close(), "close parquet file")
+}
+
+// WriteParquetPartitioned writes candles of every ticker into its own
+// <dir>/ticker=<ticker>/data.parquet file, the layout of Hive partitions
+func WriteParquetPartitioned(dir string, data []OHLCV) error {
+	var tickers []string
+	partitions := make(map[string][]OHLCV)
+	for _, ohlc := range data {
+		if _, ok := partitions[ohlc.Ticker]; !ok {
+			tickers = append(tickers, ohlc.Ticker)
+		}
+		partitions[ohlc.Ticker] = append(partitions[ohlc.Ticker], ohlc)
+	}
+
+	for _, ticker := range tickers {
+		partition := filepath.Join(dir, "ticker="+ticker)
+		if err := os.MkdirAll(partition, 0755); err != nil {
+			return errors.Wrap(err, "create partition directory")
+		}
+		if err := WriteParquet(filepath.Join(partition, "data.parquet"), partitions[ticker]); err != nil {
+			return errors.Wrapf(err, "write %s partition", ticker)
+		}
+	}
+	return nil
+}
+
+// parquetChunk is a written column chunk of a single data page
+type parquetChunk struct {
+	column parquetColumn
+	offset int64
+	size   int64
+}
+
+// parquetPageHeader encodes header of a data page of required column values
+func parquetPageHeader(values, size int) []byte {
+	var w compactWriter
+	w.i32(1, parquetDataPage)
+	w.i32(2, int32(size))
+	w.i32(3, int32(size))
+	w.beginStruct(5)
+	w.i32(1, int32(values))
+	w.i32(2, parquetPlain)
+	w.i32(3, parquetRLE)
+	w.i32(4, parquetRLE)
+	w.end()
+	w.stop()
+	return w.Bytes()
+}
+
+// parquetFooter encodes file metadata of a single row group
+func parquetFooter(chunks []parquetChunk, rows int64) []byte {
+	var w compactWriter
+	w.i32(1, 1)
+
+	w.beginList(2, compactStruct, len(chunks)+1)
+	w.beginElement()
+	w.str(4, "schema")
+	w.i32(5, int32(len(chunks)))
+	w.end()
+	for _, chunk := range chunks {
+		w.beginElement()
+		w.i32(1, chunk.column.typ)
+		w.i32(3, parquetRequired)
+		w.str(4, chunk.column.name)
+		if chunk.column.converted >= 0 {
+			w.i32(6, chunk.column.converted)
+		}
+		w.end()
+	}
+
+	w.i64(3, rows)
+
+	var total int64
+	w.beginList(4, compactStruct, 1)
+	w.beginElement()
+	w.beginList(1, compactStruct, len(chunks))
+	for _, chunk := range chunks {
+		w.beginElement()
+		w.i64(2, chunk.offset)
+		w.beginStruct(3)
+		w.i32(1, chunk.column.typ)
+		w.beginList(2, compactI32, 2)
+		w.zigzag(parquetPlain)
+		w.zigzag(parquetRLE)
+		w.beginList(3, compactBinary, 1)
+		w.varint(uint64(len(chunk.column.name)))
+		w.WriteString(chunk.column.name)
+		w.i32(4, 0) // uncompressed
+		w.i64(5, rows)
+		w.i64(6, chunk.size)
+		w.i64(7, chunk.size)
+		w.i64(9, chunk.offset)
+		w.end()
+		w.end()
+		total += chunk.size
+	}
+	w.i64(2, total)
+	w.i64(3, rows)
+	w.end()
+
+	w.str(6, "moex-history-downloader")
+	w.stop()
+	return w.Bytes()
+}
+
+// Thrift compact protocol types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes Parquet metadata structs with Thrift compact protocol
+type compactWriter struct {
+	bytes.Buffer
+	// last is the previous field id of the current struct
+	last int16
+	// parents are last field ids of enclosing structs
+	parents []int16
+}
+
+func (w *compactWriter) varint(v uint64) {
+	for v >= 0x80 {
+		w.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	w.WriteByte(byte(v))
+}
+
+func (w *compactWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *compactWriter) field(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	w.last = id
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.field(id, compactI32)
+	w.zigzag(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.field(id, compactI64)
+	w.zigzag(v)
+}
+
+func (w *compactWriter) str(id int16, s string) {
+	w.field(id, compactBinary)
+	w.varint(uint64(len(s)))
+	w.WriteString(s)
+}
+
+func (w *compactWriter) beginList(id int16, elem byte, size int) {
+	w.field(id, compactList)
+	if size < 15 {
+		w.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	w.WriteByte(0xf0 | elem)
+	w.varint(uint64(size))
+}
+
+// beginStruct begins struct field, it is finished with end
+func (w *compactWriter) beginStruct(id int16) {
+	w.field(id, compactStruct)
+	w.beginElement()
+}
+
+// beginElement begins struct list element, it is finished with end
+func (w *compactWriter) beginElement() {
+	w.parents = append(w.parents, w.last)
+	w.last = 0
+}
+
+func (w *compactWriter) end() {
+	w.stop()
+	w.last = w.parents[len(w.parents)-1]
+	w.parents = w.parents[:len(w.parents)-1]
+}
+
+// stop finishes the current struct
+func (w *compactWriter) stop() {
+	w.WriteByte(0)
+}
@@ -0,0 +1,241 @@
+package history
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// compactReader decodes Thrift compact protocol structs into maps of field
+// ids to values: int64 for integers, string for binaries, []any for lists and
+// map[int16]any for structs. It covers types Parquet metadata uses.
+type compactReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *compactReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.err = errors.New("unexpected end of thrift data")
+		return 0
+	}
+	r.pos++
+	return r.buf[r.pos-1]
+}
+
+func (r *compactReader) varint() uint64 {
+	var v uint64
+	for shift := 0; shift < 64 && r.err == nil; shift += 7 {
+		b := r.byte()
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+	return v
+}
+
+func (r *compactReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, compactI32, compactI64:
+		return r.zigzag()
+	case compactBinary:
+		size := int(r.varint())
+		if r.pos+size > len(r.buf) {
+			r.err = errors.New("binary exceeds thrift data")
+			return ""
+		}
+		r.pos += size
+		return string(r.buf[r.pos-size : r.pos])
+	case compactList:
+		header := r.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]any, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			if elem == 1 || elem == 2 {
+				list = append(list, r.byte() == 1)
+				continue
+			}
+			list = append(list, r.value(elem))
+		}
+		return list
+	case compactStruct:
+		return r.fields()
+	}
+	r.err = errors.New("unsupported thrift type")
+	return nil
+}
+
+func (r *compactReader) fields() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+	return fields
+}
+
+// decodeParquet reads footer and data pages of a file written by WriteParquet
+// back into candles, checking metadata along the way
+func decodeParquet(t *testing.T, path string) []OHLCV {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) < 12 || string(content[:4]) != parquetMagic || string(content[len(content)-4:]) != parquetMagic {
+		t.Fatal("no parquet magic")
+	}
+	size := int(binary.LittleEndian.Uint32(content[len(content)-8:]))
+	footer := &compactReader{buf: content[len(content)-8-size : len(content)-8]}
+	meta := footer.fields()
+	if footer.err != nil || footer.pos != size {
+		t.Fatalf("decode footer: %v, read %d of %d bytes", footer.err, footer.pos, size)
+	}
+
+	if meta[1] != int64(1) {
+		t.Errorf("got version %v", meta[1])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(parquetColumns)+1 || schema[0].(map[int16]any)[5] != int64(len(parquetColumns)) {
+		t.Fatalf("got schema %v", schema)
+	}
+	for i, column := range parquetColumns {
+		element := schema[i+1].(map[int16]any)
+		if element[4] != column.name || element[1] != int64(column.typ) || element[3] != int64(parquetRequired) {
+			t.Errorf("got schema element %v for %s", element, column.name)
+		}
+		if converted, ok := element[6]; ok != (column.converted >= 0) || ok && converted != int64(column.converted) {
+			t.Errorf("got converted type %v for %s", converted, column.name)
+		}
+	}
+	rows := int(meta[3].(int64))
+
+	groups := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("got %d row groups", len(groups))
+	}
+	group := groups[0].(map[int16]any)
+	if group[3] != int64(rows) {
+		t.Errorf("got %v row group rows, want %d", group[3], rows)
+	}
+
+	data := make([]OHLCV, rows)
+	for i, chunk := range group[1].([]any) {
+		column := parquetColumns[i]
+		chunkMeta := chunk.(map[int16]any)[3].(map[int16]any)
+		if path := chunkMeta[3].([]any); len(path) != 1 || path[0] != column.name || chunkMeta[5] != int64(rows) {
+			t.Fatalf("got column chunk %v for %s", chunkMeta, column.name)
+		}
+
+		offset := int(chunkMeta[9].(int64))
+		page := &compactReader{buf: content[offset : offset+int(chunkMeta[7].(int64))]}
+		header := page.fields()
+		values := header[5].(map[int16]any)
+		if page.err != nil || header[1] != int64(parquetDataPage) || values[1] != int64(rows) || values[2] != int64(parquetPlain) {
+			t.Fatalf("got page header %v for %s: %v", header, column.name, page.err)
+		}
+		plain := page.buf[page.pos:]
+		if len(plain) != int(header[2].(int64)) {
+			t.Fatalf("got %d bytes of %s values, header says %v", len(plain), column.name, header[2])
+		}
+
+		for row := range data {
+			ohlc := &data[row]
+			switch column.typ {
+			case parquetByteArray:
+				n := binary.LittleEndian.Uint32(plain)
+				ohlc.Ticker, plain = string(plain[4:4+n]), plain[4+n:]
+				continue
+			case parquetDouble:
+				value := math.Float64frombits(binary.LittleEndian.Uint64(plain))
+				*map[string]*float64{"open": &ohlc.Open, "high": &ohlc.High, "low": &ohlc.Low,
+					"close": &ohlc.Close, "value": &ohlc.Value}[column.name] = value
+			case parquetInt64:
+				value := int64(binary.LittleEndian.Uint64(plain))
+				if column.name == "date" {
+					ohlc.Date = time.UnixMilli(value)
+				} else {
+					*map[string]*int64{"volume": &ohlc.Volume, "openoi": &ohlc.OpenOI, "closeoi": &ohlc.CloseOI}[column.name] = value
+				}
+			}
+			plain = plain[8:]
+		}
+	}
+	return data
+}
+
+func TestWriteParquet(t *testing.T) {
+	data := minuteCandles("SiH4", moscowTime(2024, 1, 10, 10, 0), 20)
+	for i := range data {
+		data[i].Value = float64(i) * 1000.25
+		data[i].OpenOI, data[i].CloseOI = int64(120000+i), int64(120001+i)
+	}
+	data[3].Low = 0.00012345
+
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := WriteParquet(path, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got := decodeParquet(t, path)
+	if len(got) != len(data) {
+		t.Fatalf("got %d rows, want %d", len(got), len(data))
+	}
+	for i, want := range data {
+		g := got[i]
+		if g.Ticker != want.Ticker || !g.Date.Equal(want.Date) || g.Open != want.Open || g.High != want.High ||
+			g.Low != want.Low || g.Close != want.Close || g.Volume != want.Volume || g.Value != want.Value ||
+			g.OpenOI != want.OpenOI || g.CloseOI != want.CloseOI {
+			t.Errorf("row %d: got %+v, want %+v", i, g, want)
+		}
+	}
+}
+
+func TestWriteParquetPartitioned(t *testing.T) {
+	data := append(minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3),
+		minuteCandles("GAZP", moscowTime(2024, 1, 10, 10, 0), 2)...)
+
+	dir := t.TempDir()
+	if err := WriteParquetPartitioned(dir, data); err != nil {
+		t.Fatal(err)
+	}
+
+	for ticker, rows := range map[string]int{"SBER": 3, "GAZP": 2} {
+		got := decodeParquet(t, filepath.Join(dir, "ticker="+ticker, "data.parquet"))
+		if len(got) != rows {
+			t.Errorf("got %d %s rows, want %d", len(got), ticker, rows)
+		}
+		for _, ohlc := range got {
+			if ohlc.Ticker != ticker {
+				t.Errorf("got %s row in %s partition", ohlc.Ticker, ticker)
+			}
+		}
+	}
+}
@@ -0,0 +1,568 @@
+package history
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessOptions configures batch processing of instruments into files
+type ProcessOptions struct {
+	// Engine, Market and Board override ISS coordinates of instruments,
+	// processor defaults are used for empty values. Empty board of overridden
+	// engine or market is the first of BoardChain. ProcessShares downloads
+	// any instruments month by month, e.g. currency pairs on CETS board.
+	Engine string
+	Market string
+	Board  string
+	// OutputDir is a directory for output files, current directory is used when empty
+	OutputDir string
+	// Writer configures output files layout
+	Writer Writer
+	// RequestDelay is a pause after every monthly request of a share to avoid
+	// overwhelming ISS, DefaultRequestDelay when zero, negative disables it
+	RequestDelay time.Duration
+	// Concurrency limits instruments processed in parallel,
+	// DefaultConcurrency when zero, negative means sequential processing
+	Concurrency int
+	// Interval is the candles interval, see Interval constants
+	Interval int
+	// FilenameTemplate names output files using {ticker}, {board}, {interval},
+	// {period} and {year} placeholders, e.g. "{board}_{ticker}_{interval}.csv".
+	// {period} is IntervalSuffix of the interval, e.g. D for daily candles.
+	// {year} is the first year of the processed range or the file year with
+	// SplitByYear. "{ticker}.txt", or "{ticker}_{year}.txt" with SplitByYear, when
+	// empty. Period is appended to ticker for other than 1 minute intervals,
+	// e.g. "{ticker}_{period}.txt", so files of different intervals don't collide.
+	FilenameTemplate string
+	// SplitByYear writes futures root contracts into a file per expiration
+	// year instead of a single file spanning all years
+	SplitByYear bool
+	// Storer receives candles of all instruments instead of per instrument
+	// files written atomically by default, e.g. SQLiteStorer or NDJSONStream
+	Storer Storer
+	// Gzip compresses output files adding .gz extension to their names
+	Gzip bool
+	// PartitionByInterval writes files into <OutputDir>/<Interval>/ subdirectories
+	PartitionByInterval bool
+	// Force rewrites existing files in place, by default data is written
+	// into a temporary file replacing the existing one only on success
+	Force bool
+	// CommitPerPeriod commits output file after every downloaded month of
+	// shares and contract of futures, so a crash loses the current period only.
+	// New and appended files are committed in place, a complete existing file
+	// being refreshed is replaced only once all periods succeed.
+	CommitPerPeriod bool
+	// Incremental resumes existing files fetching candles from
+	// the last timestamp already written instead of full refresh.
+	// The last row is replaced, as it may hold a bar of an unfinished
+	// session. Files whose last row doesn't parse with Writer layout
+	// fail. Compressed files and files with Adjustments can't be resumed
+	// and are always refreshed.
+	Incremental bool
+	// Validate checks shares tickers are traded on the board before downloading
+	// and fails listing unknown ones, it costs an extra request. Delisted shares
+	// are reported as unknown.
+	Validate bool
+	// Adjustments supplies corporate actions of shares, candles get AdjClose
+	// adjusted with them, see Writer.AdjClose to write it. Files are refreshed
+	// as a whole, so earlier rows get adjusted by newly announced actions.
+	Adjustments AdjustFunc
+	// FirstTradeDates are known first trade dates of shares, months before
+	// them are skipped without requests
+	FirstTradeDates map[string]time.Time
+	// ClampToFirstCandle requests first candle date of shares missing in
+	// FirstTradeDates, see Fetcher.FirstCandleDate, so months before listing
+	// are skipped too. It costs an extra request per share.
+	ClampToFirstCandle bool
+	// YearDigits is the year suffix width of futures contract identifiers
+	// written to output, e.g. 2 gives SiH26. ISS native single digit
+	// suffix is used when less than 2.
+	YearDigits int
+	// MinVolume drops candles traded less than MinVolume before writing,
+	// e.g. to filter noise of illiquid instruments. Zero keeps all candles.
+	MinVolume int64
+	// MinBars is the minimum expected number of candles per instrument,
+	// instruments with fewer candles are flagged as under-covered in Report
+	MinBars int
+	// MaxRuntime limits duration of the whole run, processing is cancelled
+	// once it elapses and PartialError is returned. Zero means no limit.
+	MaxRuntime time.Duration
+	// FailFast stops the whole run on the first failed instrument, by default
+	// other instruments are processed and failures are collected in Report
+	FailFast bool
+	// LogLevel controls printed lines: dry run requests at LogInfo,
+	// per period details at LogDebug
+	LogLevel LogLevel
+	// Progress receives per instrument start and finish events, e.g. PrintProgress
+	Progress ProgressFunc
+	// WriteCoverage writes <name>.coverage.csv next to the output file
+	// listing detected gaps with their start, end and missing bars count
+	WriteCoverage bool
+	// WriteSummary writes summary.json into OutputDir once the run is over,
+	// see Report.WriteSummary
+	WriteSummary bool
+	// WriteChecksum writes <name>.sha256 sidecar with SHA-256 and rows count
+	// next to the output file whenever it is committed, see Verify. Existing
+	// file is verified against its sidecar before it is appended to.
+	WriteChecksum bool
+	// WriteDoneMarker creates <name>.done file next to the output file
+	// once it is completely and successfully written
+	WriteDoneMarker bool
+	// DryRun prints requests and target files instead of downloading,
+	// planned requests are returned in Report. Nothing is written.
+	DryRun bool
+}
+
+// DefaultRequestDelay is the default pause between monthly requests of a share
+const DefaultRequestDelay = 100 * time.Millisecond
+
+// requestDelay returns configured RequestDelay or the default one
+func (opts ProcessOptions) requestDelay() time.Duration {
+	if opts.RequestDelay == 0 {
+		return DefaultRequestDelay
+	}
+	return opts.RequestDelay
+}
+
+// coordinates returns configured ISS engine, market and board falling back to
+// defaults, board of overridden engine or market is the first of its BoardChain
+func (opts ProcessOptions) coordinates(engine, market, board string) (string, string, string) {
+	if opts.Engine != "" {
+		engine = opts.Engine
+	}
+	if opts.Market != "" {
+		market = opts.Market
+	}
+	switch {
+	case opts.Board != "":
+		board = opts.Board
+	case opts.Engine != "" || opts.Market != "":
+		// Board of the processor defaults doesn't trade other markets
+		board = ""
+		if boards := BoardChain(engine, market); len(boards) > 0 {
+			board = boards[0]
+		}
+	}
+	return engine, market, board
+}
+
+// withMaxRuntime returns ctx cancelled once MaxRuntime elapses when it is set
+func (opts ProcessOptions) withMaxRuntime(ctx context.Context) (context.Context, context.CancelFunc) {
+	if opts.MaxRuntime > 0 {
+		return context.WithTimeout(ctx, opts.MaxRuntime)
+	}
+	return context.WithCancel(ctx)
+}
+
+// finishRun records run duration, writes summary when configured and returns
+// error of the run limited with ctx, see runError
+func finishRun(
+	ctx context.Context, opts ProcessOptions, dir string, report *Report, started time.Time, err error,
+) error {
+	report.Elapsed = time.Since(started)
+	err = runError(ctx, opts, report, err)
+
+	if opts.WriteSummary && !opts.DryRun {
+		if summaryErr := report.WriteSummary(filepath.Join(dir, summaryFileName)); summaryErr != nil {
+			return errors.Join(err, summaryErr)
+		}
+	}
+	return err
+}
+
+// runError returns error of the whole run limited with ctx: PartialError when
+// MaxRuntime elapsed, err stopping the run or joined instrument errors
+func runError(ctx context.Context, opts ProcessOptions, report *Report, err error) error {
+	if opts.MaxRuntime > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &PartialError{MaxRuntime: opts.MaxRuntime, Finished: report.Finished()}
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// withIntervalLayout returns options omitting meaningless time column
+// of daily and longer candles unless Writer.KeepTime is set
+func (opts ProcessOptions) withIntervalLayout() ProcessOptions {
+	if _, intraday := intradayDuration(opts.Interval); !intraday && !opts.Writer.KeepTime {
+		opts.Writer.OmitTime = true
+	}
+	return opts
+}
+
+// withFetcherLocation returns options writing <DATE> and <TIME> in the time
+// zone fetcher parses ISS timestamps in unless Writer.Location is set, so
+// candles fetched with ParseUTC keep ISS wall clock
+func (opts ProcessOptions) withFetcherLocation(fetcher *Fetcher) ProcessOptions {
+	if opts.Writer.Location == nil {
+		opts.Writer.Location = fetcher.location()
+	}
+	return opts
+}
+
+// outputDir resolves the directory output files are written to
+func outputDir(opts ProcessOptions) (string, error) {
+	if opts.OutputDir != "" {
+		if opts.DryRun {
+			return opts.OutputDir, nil
+		}
+		if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create output directory: %w", err)
+		}
+		return opts.OutputDir, nil
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return currentDir, nil
+}
+
+const (
+	// defaultFilenameTemplate keeps one text file per instrument
+	defaultFilenameTemplate = "{ticker}.txt"
+	// yearFilenameTemplate keeps one text file per instrument and year
+	yearFilenameTemplate = "{ticker}_{year}.txt"
+)
+
+// pathVars are values substituted into FilenameTemplate placeholders
+type pathVars struct {
+	ticker string
+	board  string
+	year   int
+}
+
+// outputPath builds instrument file path from filename template,
+// partitioned by interval when configured
+func outputPath(dir string, opts ProcessOptions, vars pathVars) (string, error) {
+	if opts.PartitionByInterval {
+		dir = filepath.Join(dir, strconv.Itoa(opts.Interval))
+	}
+
+	template := opts.FilenameTemplate
+	if template == "" {
+		template = defaultFilenameTemplate
+		if opts.SplitByYear {
+			template = yearFilenameTemplate
+		}
+		if opts.Interval != IntervalMinute1 {
+			template = strings.Replace(template, "{ticker}", "{ticker}_{period}", 1)
+		}
+	}
+	name := strings.NewReplacer(
+		"{ticker}", vars.ticker,
+		"{board}", vars.board,
+		"{interval}", strconv.Itoa(opts.Interval),
+		"{period}", IntervalSuffix(opts.Interval),
+		"{year}", strconv.Itoa(vars.year),
+	).Replace(template)
+
+	if opts.Gzip {
+		name += ".gz"
+	}
+
+	fileName := filepath.Join(dir, name)
+	if opts.DryRun {
+		return fileName, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return fileName, nil
+}
+
+// planRequest records request of a dry run instead of making it
+func planRequest(opts ProcessOptions, result *TickerResult, url, fileName string) {
+	opts.LogLevel.logf(LogInfo, "Would fetch %s into %s", url, fileName)
+	result.Requests = append(result.Requests, url)
+}
+
+// tempPath returns temporary file path output is written to until complete.
+// It is kept in the same directory so that rename stays atomic.
+func tempPath(fileName string) string {
+	return fileName + ".tmp"
+}
+
+// sink receives candles of a single instrument during processing
+type sink interface {
+	write(data []OHLCV) error
+	// checkpoint commits output written so far and continues it
+	checkpoint() error
+	// commit completes instrument output on success
+	commit(opts ProcessOptions) error
+	// abort discards incomplete instrument output on failure
+	abort()
+}
+
+// createSink opens instrument output, configured Storer or atomically written
+// file, see createOutput for keep
+func createSink(ticker, fileName string, opts ProcessOptions, keep int64) (sink, error) {
+	if opts.Storer != nil {
+		return storerSink{storer: opts.Storer, ticker: ticker}, nil
+	}
+	return createOutput(fileName, opts, keep)
+}
+
+// output is an instrument file being written
+type output struct {
+	writer    Writer
+	file      *os.File
+	gz        *gzip.Writer
+	w         io.Writer
+	fileName  string
+	writePath string
+	checksum  bool
+	// vwap carries session VWAP across writes and over appended rows
+	vwap *vwapSession
+	// committed is the file size at the last checkpoint, abort truncates
+	// the file back to it. It is negative before the first checkpoint.
+	committed int64
+	// replaces is set while a complete existing file is being refreshed,
+	// it isn't replaced by checkpoints of a part of new content
+	replaces bool
+}
+
+// createOutput opens instrument file for writing. Unless Force is set data is
+// written into a temporary file which replaces fileName on commit, so a failed
+// run never leaves a partially written file. Data is appended after the first
+// keep bytes of existing file content, the file is started over with the
+// header when keep is negative. With Gzip appended data is written as another
+// gzip member of the file.
+func createOutput(fileName string, opts ProcessOptions, keep int64) (*output, error) {
+	if err := removeDoneMarker(fileName); err != nil {
+		return nil, err
+	}
+
+	writePath := fileName
+	if !opts.Force {
+		writePath = tempPath(fileName)
+	}
+
+	// Empty file has no header to continue, it is started over
+	info, statErr := os.Stat(fileName)
+	exists := statErr == nil && info.Size() > 0
+	appendExisting := keep > 0 && exists
+
+	// Don't append to a file damaged since it was committed
+	if appendExisting && opts.WriteChecksum {
+		if _, err := os.Stat(checksumPath(fileName)); err == nil {
+			if err := Verify(fileName, opts.Writer); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var file *os.File
+	var err error
+	switch {
+	case appendExisting && opts.Force:
+		if file, err = os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644); err == nil && keep < info.Size() {
+			if err = file.Truncate(keep); err != nil {
+				file.Close()
+			}
+		}
+	case appendExisting:
+		file, err = copyFile(fileName, writePath, keep)
+	default:
+		file, err = os.Create(writePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	o := &output{
+		writer:    opts.Writer,
+		file:      file,
+		w:         file,
+		fileName:  fileName,
+		writePath: writePath,
+		checksum:  opts.WriteChecksum,
+		vwap:      &vwapSession{},
+		committed: -1,
+		replaces:  exists && !appendExisting && !opts.Force,
+	}
+	if opts.Gzip {
+		o.gz = gzip.NewWriter(file)
+		o.w = o.gz
+	}
+
+	if appendExisting && opts.Writer.VWAP {
+		if o.vwap, err = resumeVWAP(fileName, opts.Writer, keep); err != nil {
+			o.abort()
+			return nil, fmt.Errorf("failed to read VWAP session: %w", err)
+		}
+	}
+
+	if !appendExisting {
+		if err := opts.Writer.WriteHeaderTo(o); err != nil {
+			o.abort()
+			return nil, fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+
+	return o, nil
+}
+
+// Write writes p to the file, compressing it when configured
+func (o *output) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+// write appends candles to the file using writer layout
+func (o *output) write(data []OHLCV) error {
+	return o.writer.writeRows(o, data, o.vwap)
+}
+
+// close flushes compressed stream and closes the file
+func (o *output) close() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.file.Close()
+			return err
+		}
+	}
+	return o.file.Close()
+}
+
+// copyFile copies up to size bytes of src into newly created dst and returns
+// dst opened for appending
+func copyFile(src, dst string, size int64) (*os.File, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(out, io.LimitReader(in, size)); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return nil, err
+	}
+	return out, nil
+}
+
+// commit closes the file and renames temporary file to the final name,
+// writing completion marker when configured
+func (o *output) commit(opts ProcessOptions) error {
+	if err := o.close(); err != nil {
+		o.abort()
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if o.writePath != o.fileName {
+		if err := os.Rename(o.writePath, o.fileName); err != nil {
+			o.abort()
+			return fmt.Errorf("failed to replace file: %w", err)
+		}
+	}
+
+	if o.checksum {
+		if err := writeChecksum(o.fileName, o.writer); err != nil {
+			return err
+		}
+	}
+	if opts.WriteDoneMarker {
+		return writeDoneMarker(o.fileName)
+	}
+	return nil
+}
+
+// checkpoint commits the file written so far, so completed periods survive
+// a failure of the following ones. The first checkpoint renames temporary
+// file to the final name, following periods are appended in place and abort
+// truncates the file back to the last checkpoint. Refresh of a complete
+// existing file is only synced to the temporary file, the existing file is
+// replaced on commit.
+func (o *output) checkpoint() error {
+	if o.replaces {
+		if o.gz != nil {
+			if err := o.gz.Flush(); err != nil {
+				return fmt.Errorf("failed to flush file: %w", err)
+			}
+		}
+		if err := o.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file: %w", err)
+		}
+		return nil
+	}
+
+	if err := o.close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if o.writePath != o.fileName {
+		if err := os.Rename(o.writePath, o.fileName); err != nil {
+			return fmt.Errorf("failed to replace file: %w", err)
+		}
+		o.writePath = o.fileName
+	}
+	if o.checksum {
+		if err := writeChecksum(o.fileName, o.writer); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(o.fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to reopen file: %w", err)
+	}
+
+	o.file, o.w = file, file
+	o.committed = info.Size()
+	if o.gz != nil {
+		o.gz = gzip.NewWriter(file)
+		o.w = o.gz
+	}
+	return nil
+}
+
+// abort closes the file and removes temporary file, existing output stays
+// intact. File appended in place is truncated to the last checkpoint.
+func (o *output) abort() {
+	o.close()
+	if o.writePath != o.fileName {
+		os.Remove(o.writePath)
+	}
+	if o.committed >= 0 {
+		os.Truncate(o.fileName, o.committed)
+	}
+}
+
+// doneMarkerPath returns completion marker path of output file
+func doneMarkerPath(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".done"
+}
+
+// writeDoneMarker creates empty completion marker of output file
+func writeDoneMarker(fileName string) error {
+	file, err := os.Create(doneMarkerPath(fileName))
+	if err != nil {
+		return fmt.Errorf("failed to create done marker: %w", err)
+	}
+	return file.Close()
+}
+
+// removeDoneMarker removes stale completion marker before output file is rewritten
+func removeDoneMarker(fileName string) error {
+	if err := os.Remove(doneMarkerPath(fileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove done marker: %w", err)
+	}
+	return nil
+}
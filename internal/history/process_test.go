@@ -0,0 +1,275 @@
+package history
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// removeWorkingDir makes os.Getwd fail by removing the working directory
+// for the rest of the test
+func removeWorkingDir(t *testing.T) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("", "cwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Getwd(); err == nil {
+		t.Skip("working directory is still available after removal")
+	}
+}
+
+func TestOutputDirWithoutWorkingDir(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	removeWorkingDir(t)
+
+	dir, err := outputDir(ProcessOptions{OutputDir: out})
+	if err != nil {
+		t.Fatalf("configured output dir failed: %v", err)
+	}
+	if dir != out {
+		t.Errorf("got %s, want %s", dir, out)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("output dir isn't created: %v", err)
+	}
+
+	if _, err := outputDir(ProcessOptions{}); err == nil {
+		t.Error("default output dir resolved without working dir")
+	}
+}
+
+func TestPartitionByInterval(t *testing.T) {
+	dir := t.TempDir()
+	paths := make(map[int]string)
+	for _, interval := range []int{IntervalMinute1, IntervalHour} {
+		opts := ProcessOptions{Interval: interval, PartitionByInterval: true}
+		fileName, err := outputPath(dir, opts, pathVars{ticker: "SBER", board: SharesBoard, year: 2024})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[interval] = fileName
+	}
+
+	if want := filepath.Join(dir, "1", "SBER.txt"); paths[IntervalMinute1] != want {
+		t.Errorf("got %s, want %s", paths[IntervalMinute1], want)
+	}
+	if want := filepath.Join(dir, "60", "SBER_H1.txt"); paths[IntervalHour] != want {
+		t.Errorf("got %s, want %s", paths[IntervalHour], want)
+	}
+	for _, fileName := range paths {
+		if info, err := os.Stat(filepath.Dir(fileName)); err != nil || !info.IsDir() {
+			t.Errorf("subdirectory of %s isn't created", fileName)
+		}
+	}
+}
+
+func TestDoneMarkerOnlyOnSuccess(t *testing.T) {
+	dir := t.TempDir()
+	opts := ProcessOptions{
+		OutputDir:       dir,
+		Writer:          DefaultWriter(),
+		Interval:        IntervalMinute1,
+		RequestDelay:    -1,
+		WriteDoneMarker: true,
+	}
+	marker := filepath.Join(dir, "SBER.done")
+
+	fetcher := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 2)))
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("marker isn't created on success: %v", err)
+	}
+
+	// Second run fails in the middle of the year
+	fetcher = newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Query().Get("from"), "2023-06") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, candlesCSV(candlesHeader))
+	})
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("marker exists after failure: %v", err)
+	}
+}
+
+func TestWithoutHeader(t *testing.T) {
+	writer := DefaultWriter()
+	writer.WriteHeader = false
+	dir := t.TempDir()
+	opts := ProcessOptions{OutputDir: dir, Writer: writer, Interval: IntervalMinute1, RequestDelay: -1}
+
+	shares := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 1)))
+	if _, err := ProcessShares(context.Background(), shares, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+	futures := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SiH4": minuteCandles("SiH4", moscowTime(2024, 2, 1, 10, 0), 1),
+	}))
+	if _, err := ProcessFutures(context.Background(), futures, opts, 2024, 2025, "Si"); err != nil {
+		t.Fatal(err)
+	}
+
+	for ticker, want := range map[string]string{
+		"SBER": "20230301,10:00:00,100,101,99,100.5,10",
+		"Si":   "20240201,10:00:00,100,101,99,100.5,10",
+	} {
+		if got := readLines(t, filepath.Join(dir, ticker+".txt")); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: got %q, want a single data row", ticker, got)
+		}
+	}
+}
+
+// failThirdMonth serves a candle in January and February 2023 and fails March
+func failThirdMonth(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	switch {
+	case strings.HasPrefix(from, "2023-01"):
+		servePages(minuteCandles("SBER", moscowTime(2023, 1, 10, 10, 0), 1))(w, r)
+	case strings.HasPrefix(from, "2023-02"):
+		servePages(minuteCandles("SBER", moscowTime(2023, 2, 10, 10, 0), 1))(w, r)
+	case strings.HasPrefix(from, "2023-03"):
+		w.WriteHeader(http.StatusServiceUnavailable)
+	default:
+		servePages(nil)(w, r)
+	}
+}
+
+func TestCommitPerPeriodCrash(t *testing.T) {
+	dir := t.TempDir()
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, CommitPerPeriod: true}
+
+	if _, err := ProcessShares(context.Background(), newTestFetcher(failThirdMonth), opts, 2023, 2023, "SBER"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	want := []string{
+		"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"20230110,10:00:00,100,101,99,100.5,10",
+		"20230210,10:00:00,100,101,99,100.5,10",
+	}
+	fileName := filepath.Join(dir, "SBER.txt")
+	if got := readLines(t, fileName); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := os.Stat(tempPath(fileName)); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+}
+
+func TestCommitPerPeriodAppendsInPlace(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "SBER.txt")
+	existing := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n20221230,10:00:00,1,1,1,1,1\n"
+	if err := os.WriteFile(fileName, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ProcessOptions{
+		OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1,
+		CommitPerPeriod: true, Incremental: true,
+	}
+	if _, err := ProcessShares(context.Background(), newTestFetcher(failThirdMonth), opts, 2023, 2023, "SBER"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	want := existing + "20230110,10:00:00,100,101,99,100.5,10\n20230210,10:00:00,100,101,99,100.5,10\n"
+	if content, _ := os.ReadFile(fileName); string(content) != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestCommitPerPeriodKeepsRefreshedFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "SBER.txt")
+	existing := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n20221230,10:00:00,1,1,1,1,1\n"
+	if err := os.WriteFile(fileName, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, CommitPerPeriod: true}
+	if _, err := ProcessShares(context.Background(), newTestFetcher(failThirdMonth), opts, 2023, 2023, "SBER"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Complete file isn't replaced by a part of its refresh
+	if content, _ := os.ReadFile(fileName); string(content) != existing {
+		t.Errorf("got\n%s\nwant existing content", content)
+	}
+	if _, err := os.Stat(tempPath(fileName)); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+}
+
+// readGzipLines decompresses file and returns its lines
+func readGzipLines(t *testing.T, fileName string) []string {
+	t.Helper()
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestGzipOutput(t *testing.T) {
+	dir := t.TempDir()
+	data := minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 2)
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, Gzip: true}
+	if _, err := ProcessShares(context.Background(), newTestFetcher(servePages(data)), opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+
+	fileName := filepath.Join(dir, "SBER.txt.gz")
+	want := []string{
+		"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"20230301,10:00:00,100,101,99,100.5,10",
+		"20230301,10:01:00,101,102,100,101.5,11",
+	}
+	if got := readGzipLines(t, fileName); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Compressed file can't be resumed, incremental run refreshes it
+	opts.Incremental = true
+	data = append(data, minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 2), 1)...)
+	if _, err := ProcessShares(context.Background(), newTestFetcher(servePages(data)), opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "20230301,10:02:00,100,101,99,100.5,10")
+	if got := readGzipLines(t, fileName); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q after incremental run, want %q", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProgressEvent describes processing progress of an instrument,
+// it is sent when processing starts and once more when it is done
+type ProgressEvent struct {
+	Ticker string
+	Done   bool
+	// Rows, Elapsed and Err are set for finished instruments
+	Rows    int
+	Elapsed time.Duration
+	Err     error
+}
+
+// ProgressFunc receives progress events, it is called concurrently
+// for instruments processed in parallel
+type ProgressFunc func(ProgressEvent)
+
+// PrintProgress is a ProgressFunc printing progress lines to stdout
+func PrintProgress(event ProgressEvent) {
+	switch {
+	case !event.Done:
+		fmt.Printf("Started %s\n", event.Ticker)
+	case event.Err != nil:
+		fmt.Printf("Failed %s after %s: %v\n", event.Ticker, event.Elapsed.Round(time.Millisecond), event.Err)
+	default:
+		fmt.Printf("Finished %s: %d rows in %s\n", event.Ticker, event.Rows, event.Elapsed.Round(time.Millisecond))
+	}
+}
+
+// track runs instrument processing, reports its progress and records result.
+// Error is returned only with FailFast to stop other instruments.
+func track(opts ProcessOptions, report *Report, ticker string, process func() (TickerResult, error)) error {
+	if opts.Progress != nil {
+		opts.Progress(ProgressEvent{Ticker: ticker})
+	}
+
+	started := time.Now()
+	result, err := process()
+	result.Elapsed = time.Since(started)
+	result.Err = err
+	report.add(result)
+
+	if opts.Progress != nil {
+		opts.Progress(ProgressEvent{Ticker: ticker, Done: true, Rows: result.Rows, Elapsed: result.Elapsed, Err: err})
+	}
+
+	if opts.FailFast {
+		return err
+	}
+	return nil
+}
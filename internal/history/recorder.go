@@ -0,0 +1,150 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Recorder is an http.RoundTripper recording ISS interactions into a cassette
+// file and replaying them later without network, e.g. for offline tests:
+//
+//	rec, err := NewRecorder("testdata/sber.json", false)
+//	fetcher := &Fetcher{Client: &http.Client{Transport: rec}}
+//	// fetch candles once with network, then
+//	err = rec.Save()
+//
+// and with replay set to true the same requests are served from the cassette.
+type Recorder struct {
+	// Transport makes recorded requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+
+	cassette string
+	replay   bool
+
+	mu           sync.Mutex
+	interactions []interaction
+	// replayed marks interactions already served in replay mode
+	replayed []bool
+}
+
+// interaction is a recorded request and its response
+type interaction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// NewRecorder returns Recorder of cassette file. In replay mode recorded
+// interactions are loaded from the file and requests are never sent,
+// otherwise they are recorded and written to the file by Save.
+func NewRecorder(cassette string, replay bool) (*Recorder, error) {
+	r := &Recorder{cassette: cassette, replay: replay}
+	if !replay {
+		return r, nil
+	}
+
+	content, err := os.ReadFile(cassette)
+	if err != nil {
+		return nil, errors.Wrap(err, "read cassette")
+	}
+	if err := json.Unmarshal(content, &r.interactions); err != nil {
+		return nil, errors.Wrap(err, "parse cassette")
+	}
+	r.replayed = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// RoundTrip replays recorded response of the request or sends it recording
+// the response. Identical requests are replayed in recorded order.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.replay {
+		return r.replayResponse(req)
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// Let transport decompress responses so cassettes keep plain text
+	req = req.Clone(req.Context())
+	req.Header.Del("Accept-Encoding")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, interaction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   string(body),
+	})
+	return resp, nil
+}
+
+// replayResponse returns the first not yet replayed response recorded for
+// the request, the last recorded one when all of them were replayed
+func (r *Recorder) replayResponse(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, recorded := range r.interactions {
+		if recorded.Method != req.Method || recorded.URL != req.URL.String() {
+			continue
+		}
+		found = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, errors.Errorf("no recorded interaction for %s %s", req.Method, req.URL)
+	}
+	r.replayed[found] = true
+
+	recorded := r.interactions[found]
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode: recorded.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     recorded.Header,
+		Body:       io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		Request:    req,
+	}, nil
+}
+
+// Save writes recorded interactions into the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode cassette")
+	}
+	return errors.Wrap(os.WriteFile(r.cassette, content, 0644), "write cassette")
+}
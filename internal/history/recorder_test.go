@@ -0,0 +1,52 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorderReplay(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "sber.json")
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), pageSize+20)
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	rec, err := NewRecorder(cassette, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Transport = handlerTransport{handler: servePages(data)}
+	recorded, err := (&Fetcher{Client: &http.Client{Transport: rec}}).Fetch(
+		context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewRecorder(cassette, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := &Fetcher{Client: &http.Client{Transport: replay}}
+	replayed, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed) != len(data) {
+		t.Fatalf("got %d replayed candles, want %d", len(replayed), len(data))
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Error("replayed candles differ from recorded ones")
+	}
+
+	// Requests missing in the cassette are never sent
+	if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "GAZP", day, day, IntervalMinute1); err == nil {
+		t.Error("expected error of unrecorded request")
+	}
+}
@@ -0,0 +1,147 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TickerResult describes outcome of processing a single instrument
+type TickerResult struct {
+	Ticker   string
+	FileName string
+	// Rows is the number of candles written
+	Rows int
+	// UnderCovered is set when fewer than ProcessOptions.MinBars candles were fetched
+	UnderCovered bool
+	Elapsed      time.Duration
+	// First and Last are dates of the first and the last written candles
+	First time.Time
+	Last  time.Time
+	// Gaps are absent bars ranges detected in written candles
+	Gaps []Gap
+	// Err is set when processing of the instrument failed
+	Err error
+	// Requests are first page urls planned by a dry run
+	Requests []string
+}
+
+// Report summarizes a processing run, it is safe for concurrent use
+type Report struct {
+	mu      sync.Mutex
+	Results []TickerResult
+	// Elapsed is the duration of the whole run
+	Elapsed time.Duration
+}
+
+// add records instrument result
+func (r *Report) add(result TickerResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Results = append(r.Results, result)
+}
+
+// UnderCovered returns sorted tickers fetched with fewer than MinBars candles
+func (r *Report) UnderCovered() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tickers []string
+	for _, result := range r.Results {
+		if result.UnderCovered {
+			tickers = append(tickers, result.Ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// Summary returns a line with total rows, written files and failures of the run
+func (r *Report) Summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows, files, failures, requests int
+	for _, result := range r.Results {
+		requests += len(result.Requests)
+		rows += result.Rows
+		if result.Err != nil {
+			failures++
+		} else if result.FileName != "" {
+			files++
+		}
+	}
+
+	if requests > 0 {
+		return fmt.Sprintf("Dry run: %d requests into %d files, %d failures", requests, files, failures)
+	}
+	return fmt.Sprintf("Total: %d rows, %d files written, %d failures", rows, files, failures)
+}
+
+// Finished returns sorted tickers processed successfully
+func (r *Report) Finished() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tickers []string
+	for _, result := range r.Results {
+		if result.Err == nil {
+			tickers = append(tickers, result.Ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// PartialError is returned when the run is stopped by ProcessOptions.MaxRuntime
+// before all instruments are processed
+type PartialError struct {
+	MaxRuntime time.Duration
+	// Finished are tickers processed successfully before the stop
+	Finished []string
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("max runtime %s exceeded, finished %d tickers: %s",
+		e.MaxRuntime, len(e.Finished), strings.Join(e.Finished, ", "))
+}
+
+// Unwrap makes errors.Is(err, context.DeadlineExceeded) hold
+func (e *PartialError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Errors returns errors of failed instruments keyed by ticker
+func (r *Report) Errors() map[string]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := make(map[string]error)
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed[result.Ticker] = result.Err
+		}
+	}
+	return failed
+}
+
+// Err returns errors of all failed instruments joined, nil without failures
+func (r *Report) Err() error {
+	failed := r.Errors()
+
+	tickers := make([]string, 0, len(failed))
+	for ticker := range failed {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	errs := make([]error, 0, len(tickers))
+	for _, ticker := range tickers {
+		errs = append(errs, fmt.Errorf("%s: %w", ticker, failed[ticker]))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMinBarsFlagsUnderCovered(t *testing.T) {
+	// Every month of the year serves the same candles
+	fetcher := newTestFetcher(serveContracts(map[string][]OHLCV{
+		"SBER": minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 5),
+		"ILLQ": minuteCandles("ILLQ", moscowTime(2023, 3, 1, 10, 0), 1),
+	}))
+	opts := ProcessOptions{OutputDir: t.TempDir(), Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, MinBars: 3}
+
+	report, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER", "ILLQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := report.UnderCovered(); len(got) != 1 || got[0] != "ILLQ" {
+		t.Errorf("got under-covered %v, want [ILLQ]", got)
+	}
+}
+
+func TestMaxRuntimeReportsPartialCompletion(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/securities/SLOW/") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		servePages(nil)(w, r)
+	})
+	opts := ProcessOptions{
+		OutputDir:    t.TempDir(),
+		Writer:       DefaultWriter(),
+		Interval:     IntervalMinute1,
+		RequestDelay: -1,
+		Concurrency:  2,
+		MaxRuntime:   100 * time.Millisecond,
+	}
+
+	started := time.Now()
+	_, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "FAST", "SLOW")
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("run took %s despite max runtime", elapsed)
+	}
+
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("got %v, want PartialError", err)
+	}
+	if len(partial.Finished) != 1 || partial.Finished[0] != "FAST" {
+		t.Errorf("got finished %v, want [FAST]", partial.Finished)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("PartialError doesn't match context.DeadlineExceeded")
+	}
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrVolumeOverflow is returned when summed volume doesn't fit int64
+var ErrVolumeOverflow = errors.New("volume overflow")
+
+// addVolume returns sum of volumes or ErrVolumeOverflow instead of wrapping
+func addVolume(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrVolumeOverflow
+	}
+	return a + b, nil
+}
+
+// ErrFinerStep is returned for resampling into bars finer than source
+// candles, which would fabricate data
+var ErrFinerStep = errors.New("resample step is finer than source interval")
+
+// sourceInterval infers interval of candles sorted by Date as the smallest
+// distance between adjacent candles, false for less than two candles
+func sourceInterval(data []OHLCV) (time.Duration, bool) {
+	var interval time.Duration
+	for i := 1; i < len(data); i++ {
+		if d := data[i].Date.Sub(data[i-1].Date); d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+	return interval, interval > 0
+}
+
+// Resampler aggregates candles into coarser bars
+type Resampler struct {
+	// Step is the bar duration, bars are aligned to midnight of their date.
+	// Steps longer than a day are not supported.
+	Step time.Duration
+	// CarryForward ignores candles without trades and fills buckets having no
+	// traded candles between bars of the same day with flat bars at the previous
+	// close and zero volume. By default empty buckets are omitted and candles
+	// without trades are aggregated like others.
+	CarryForward bool
+}
+
+// Resample aggregates candles sorted by Date into Step bars,
+// ErrVolumeOverflow is returned when a bar volume exceeds int64 and
+// ErrFinerStep when Step is less than the inferred candles interval
+func (r Resampler) Resample(data []OHLCV) ([]OHLCV, error) {
+	if r.Step <= 0 || r.Step > 24*time.Hour {
+		return nil, errors.Errorf("unsupported resample step %s", r.Step)
+	}
+	if source, ok := sourceInterval(data); ok && r.Step < source {
+		return nil, errors.Wrapf(ErrFinerStep, "step %s, source interval %s", r.Step, source)
+	}
+
+	var result []OHLCV
+	for _, ohlc := range data {
+		if r.CarryForward && ohlc.Volume == 0 {
+			continue
+		}
+
+		bucket := r.bucketStart(ohlc.Date)
+		if n := len(result); n > 0 && result[n-1].Date.Equal(bucket) {
+			last := &result[n-1]
+			if ohlc.High > last.High {
+				last.High = ohlc.High
+			}
+			if ohlc.Low < last.Low {
+				last.Low = ohlc.Low
+			}
+			volume, err := addVolume(last.Volume, ohlc.Volume)
+			if err != nil {
+				return nil, errors.Wrapf(err, "resample %s at %s", ohlc.Ticker, last.Date)
+			}
+			last.Close = ohlc.Close
+			last.Volume = volume
+			last.Value += ohlc.Value
+			continue
+		}
+
+		if n := len(result); n > 0 && r.CarryForward {
+			result = append(result, r.flatBars(result[n-1], bucket)...)
+		}
+
+		ohlc.Date = bucket
+		ohlc.End = time.Time{}
+		result = append(result, ohlc)
+	}
+
+	for i := range result {
+		result[i].End = result[i].Date.Add(r.Step - time.Second)
+	}
+	return result, nil
+}
+
+// bucketStart returns beginning of the bar date belongs to
+func (r Resampler) bucketStart(date time.Time) time.Time {
+	day := sessionStart(date, date.Location())
+	return day.Add(date.Sub(day) / r.Step * r.Step)
+}
+
+// flatBars returns bars carrying prev close forward for buckets between
+// prev and the bar beginning at next of the same day
+func (r Resampler) flatBars(prev OHLCV, next time.Time) []OHLCV {
+	if !sameDay(prev, OHLCV{Date: next}) {
+		return nil
+	}
+
+	var bars []OHLCV
+	for date := prev.Date.Add(r.Step); date.Before(next); date = date.Add(r.Step) {
+		bars = append(bars, OHLCV{
+			Ticker: prev.Ticker,
+			Date:   date,
+			Open:   prev.Close,
+			High:   prev.Close,
+			Low:    prev.Close,
+			Close:  prev.Close,
+		})
+	}
+	return bars
+}
@@ -0,0 +1,69 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// sparseCandles returns minute candles at 10:00, 10:01 without trades and 10:10
+func sparseCandles() []OHLCV {
+	return []OHLCV{
+		{Ticker: "SBER", Date: moscowTime(2024, 1, 10, 10, 0), Open: 100, High: 102, Low: 99, Close: 101, Volume: 10},
+		{Ticker: "SBER", Date: moscowTime(2024, 1, 10, 10, 1), Open: 90, High: 90, Low: 90, Close: 90},
+		{Ticker: "SBER", Date: moscowTime(2024, 1, 10, 10, 10), Open: 103, High: 104, Low: 103, Close: 104, Volume: 5},
+	}
+}
+
+func TestResampleCarryForward(t *testing.T) {
+	got, err := Resampler{Step: 5 * time.Minute, CarryForward: true}.Resample(sparseCandles())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []OHLCV{
+		{Date: moscowTime(2024, 1, 10, 10, 0), Open: 100, High: 102, Low: 99, Close: 101, Volume: 10},
+		// Empty bucket carries the prior close forward
+		{Date: moscowTime(2024, 1, 10, 10, 5), Open: 101, High: 101, Low: 101, Close: 101},
+		{Date: moscowTime(2024, 1, 10, 10, 10), Open: 103, High: 104, Low: 103, Close: 104, Volume: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d bars, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Date.Equal(w.Date) || g.Open != w.Open || g.High != w.High || g.Low != w.Low || g.Close != w.Close || g.Volume != w.Volume {
+			t.Errorf("bar %d: got %+v, want %+v", i, g, w)
+		}
+	}
+	if want := moscowTime(2024, 1, 10, 10, 9).Add(59 * time.Second); !got[1].End.Equal(want) {
+		t.Errorf("got end %s of flat bar, want %s", got[1].End, want)
+	}
+}
+
+func TestResampleWithoutCarryForward(t *testing.T) {
+	got, err := Resampler{Step: 5 * time.Minute}.Resample(sparseCandles())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Candle without trades is aggregated and the empty bucket is omitted
+	if len(got) != 2 {
+		t.Fatalf("got %d bars, want 2: %v", len(got), got)
+	}
+	if got[0].Low != 90 || got[0].Close != 90 {
+		t.Errorf("got first bar %+v, want low and close of candle without trades", got[0])
+	}
+}
+
+func TestResampleFinerStep(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 5)
+
+	if _, err := (Resampler{Step: 30 * time.Second}).Resample(data); !errors.Is(err, ErrFinerStep) {
+		t.Errorf("got error %v, want %v", err, ErrFinerStep)
+	}
+	// The same step as the source interval is allowed
+	if got, err := (Resampler{Step: time.Minute}).Resample(data); err != nil || len(got) != len(data) {
+		t.Errorf("got %d bars and error %v, want %d bars", len(got), err, len(data))
+	}
+}
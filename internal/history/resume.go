@@ -0,0 +1,212 @@
+package history
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tailBlockSize is a chunk size used to read candles file from its end
+const tailBlockSize = 4096
+
+// lastLine returns the last complete non blank line of file, the offset it
+// begins at and the size of file content up to the end of the last complete
+// line, so a trailing partial line written by an interrupted run can be cut
+// off. Both \n and \r\n line endings are accepted, returned line has no line
+// ending.
+func lastLine(file *os.File) (string, int64, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	size := info.Size()
+	complete := int64(-1)
+	var tail []byte
+	for offset := size; offset > 0; {
+		n := int64(tailBlockSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		block := make([]byte, n)
+		if _, err := file.ReadAt(block, offset); err != nil && err != io.EOF {
+			return "", 0, 0, err
+		}
+		tail = append(block, tail...)
+
+		end := bytes.LastIndexByte(tail, '\n')
+		if end < 0 {
+			continue
+		}
+		if complete < 0 {
+			complete = offset + int64(end) + 1
+		}
+
+		// Skip blank lines up to the line beginning in earlier blocks
+		for end >= 0 {
+			begin := bytes.LastIndexByte(tail[:end], '\n')
+			if begin < 0 && offset > 0 {
+				break
+			}
+			if line := strings.TrimRight(string(tail[begin+1:end]), "\r"); line != "" {
+				return line, offset + int64(begin) + 1, complete, nil
+			}
+			end = begin
+		}
+	}
+
+	if complete < 0 {
+		complete = 0
+	}
+	return "", 0, complete, nil
+}
+
+// parseTimestamp parses candle timestamp from a row written with w layout
+func (w Writer) parseTimestamp(line string) (time.Time, error) {
+	fields := strings.Split(strings.TrimSpace(line), w.delimiter())
+	if w.Contract && len(fields) > 0 {
+		fields = fields[1:]
+	}
+
+	if w.Epoch {
+		if len(fields) < 1 {
+			return time.Time{}, errors.New("missing timestamp column")
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).In(w.location()), nil
+	}
+
+	if w.OmitTime {
+		if len(fields) < 1 {
+			return time.Time{}, errors.New("missing date column")
+		}
+		return time.ParseInLocation(w.dateFormat(), fields[0], w.location())
+	}
+
+	if len(fields) < 2 {
+		return time.Time{}, errors.New("missing date or time column")
+	}
+	return time.ParseInLocation(w.dateFormat()+" "+w.timeFormat(), fields[0]+" "+fields[1], w.location())
+}
+
+// LastTimestamp returns timestamp of the last complete row of candles file
+// written with w layout. Trailing partial line is ignored, false is returned
+// for missing or empty files and files containing header only.
+func LastTimestamp(fileName string, w Writer) (time.Time, bool) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+
+	line, _, _, err := lastLine(file)
+	if err != nil || line == "" {
+		return time.Time{}, false
+	}
+
+	date, err := w.parseTimestamp(line)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// resumePoint returns timestamp of the last complete row of candles file
+// written with w layout, the size of content preceding that row and the size
+// of content up to the end of it, a trailing partial line is excluded. Zero
+// time is returned for missing files and files without rows, with the size of
+// their header if any. Error is returned when the last row can't be parsed
+// with w layout, e.g. after the layout was changed.
+func resumePoint(fileName string, w Writer) (time.Time, int64, int64, error) {
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return time.Time{}, 0, 0, nil
+	}
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	defer file.Close()
+
+	line, begin, complete, err := lastLine(file)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	if line == "" || w.WriteHeader && begin == 0 {
+		return time.Time{}, complete, complete, nil
+	}
+
+	date, err := w.parseTimestamp(line)
+	if err != nil {
+		return time.Time{}, 0, 0, errors.Wrapf(err, "parse last row %q", line)
+	}
+	return date, begin, complete, nil
+}
+
+// TrimPartialLine truncates trailing incomplete line left in candles file
+// by an interrupted run, so appended rows don't merge with it
+func TrimPartialLine(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, _, size, err := lastLine(file)
+	if err != nil {
+		return err
+	}
+	if size == info.Size() {
+		return nil
+	}
+	return file.Truncate(size)
+}
+
+// parseRow parses timestamp, prices and volume of a row written with w layout
+func (w Writer) parseRow(line string) (OHLCV, error) {
+	date, err := w.parseTimestamp(line)
+	if err != nil {
+		return OHLCV{}, err
+	}
+
+	fields := strings.Split(strings.TrimSpace(line), w.delimiter())
+	first := 2
+	if w.Epoch || w.OmitTime {
+		first = 1
+	}
+	if w.Contract {
+		first++
+	}
+	if len(fields) < first+5 {
+		return OHLCV{}, errors.New("missing price columns")
+	}
+
+	ohlc := OHLCV{Date: date}
+	prices := []*float64{&ohlc.Open, &ohlc.High, &ohlc.Low, &ohlc.Close}
+	for i, price := range prices {
+		if *price, err = strconv.ParseFloat(fields[first+i], 64); err != nil {
+			return OHLCV{}, err
+		}
+	}
+	if ohlc.Volume, err = strconv.ParseInt(fields[first+4], 10, 64); err != nil {
+		return OHLCV{}, err
+	}
+	return ohlc, nil
+}
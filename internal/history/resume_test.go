@@ -0,0 +1,163 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// resumeShare runs incremental download of SBER over existing content
+func resumeShare(t *testing.T, content string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "SBER.txt")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := newTestFetcher(servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 1)))
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, Incremental: true}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err != nil {
+		t.Fatal(err)
+	}
+	return readLines(t, fileName)
+}
+
+func TestResumeEmptyFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":        "",
+		"partial line": "<DATE>,<TI",
+	} {
+		got := resumeShare(t, content)
+		want := []string{
+			"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+			"20230301,10:00:00,100,101,99,100.5,10",
+		}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestResumeAfterLastRow(t *testing.T) {
+	got := resumeShare(t, "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n"+
+		"20230301,10:00:00,100,101,99,100.5,10\n20230301,10:0")
+
+	// The partial row is trimmed and the written candle isn't repeated
+	if len(got) != 2 || got[1] != "20230301,10:00:00,100,101,99,100.5,10" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestResumeReplacesLastRow(t *testing.T) {
+	// The last run saw the 10:01 bar before it was finished
+	got := resumeShare(t, "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n"+
+		"20230301,09:59:00,1,1,1,1,1\n20230301,10:00:00,100,100,100,100,1\n")
+
+	want := []string{
+		"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"20230301,09:59:00,1,1,1,1,1",
+		"20230301,10:00:00,100,101,99,100.5,10",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResumeKeepsRowBeforeRequestedYears(t *testing.T) {
+	got := resumeShare(t, "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n20221230,18:00:00,1,1,1,1,1\n")
+
+	want := []string{
+		"<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>",
+		"20221230,18:00:00,1,1,1,1,1",
+		"20230301,10:00:00,100,101,99,100.5,10",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResumeUnparsableLastRow(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "SBER.txt")
+	content := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n20230301,10:00:00,100,101,99,100.5,10\n"
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	fetcher := newTestFetcher(countRequests(&requests, servePages(minuteCandles("SBER", moscowTime(2023, 3, 1, 10, 0), 1))))
+	// Layout changed since the file was written
+	writer := DefaultWriter()
+	writer.DateFormat = "2006-01-02"
+	opts := ProcessOptions{OutputDir: dir, Writer: writer, Interval: IntervalMinute1, RequestDelay: -1, Incremental: true}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests, want none", requests.Load())
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != content {
+		t.Errorf("got %q, want file unchanged", got)
+	}
+}
+
+func TestLastTimestamp(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "SBER.txt")
+	if _, ok := LastTimestamp(fileName, DefaultWriter()); ok {
+		t.Error("got timestamp of missing file")
+	}
+	if err := os.WriteFile(fileName, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LastTimestamp(fileName, DefaultWriter()); ok {
+		t.Error("got timestamp of empty file")
+	}
+
+	content := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n20230301,10:00:00,100,101,99,100.5,10\n"
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := LastTimestamp(fileName, DefaultWriter())
+	if want := moscowTime(2023, 3, 1, 10, 0); !ok || !got.Equal(want) {
+		t.Errorf("got %s, %v, want %s", got, ok, want)
+	}
+}
+
+func TestReadCRLFFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "SBER.txt")
+	complete := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\r\n" +
+		"20230301,10:00:00,100,101,99,100.5,10\r\n" +
+		"20230301,10:01:00,101,102,100,101.5,11\r\n"
+	if err := os.WriteFile(fileName, []byte(complete+"20230301,10:0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := TrimPartialLine(fileName); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != complete {
+		t.Errorf("got content %q after trim, want %q", content, complete)
+	}
+
+	got, ok := LastTimestamp(fileName, DefaultWriter())
+	if want := moscowTime(2023, 3, 1, 10, 1); !ok || !got.Equal(want) {
+		t.Errorf("got %s, %v, want %s", got, ok, want)
+	}
+
+	ohlc, err := DefaultWriter().parseRow("20230301,10:01:00,101,102,100,101.5,11\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ohlc.Volume != 11 || ohlc.Close != 101.5 {
+		t.Errorf("got %+v of CRLF row", ohlc)
+	}
+}
@@ -0,0 +1,224 @@
+package history
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy configures repeating of failed ISS requests.
+// Zero value makes a single attempt without retries.
+type RetryPolicy struct {
+	// MaxRetries is a number of repeats after the first failed attempt
+	MaxRetries int
+	// Delay is a pause between attempts
+	Delay time.Duration
+	// Jitter adds a random pause up to Jitter to every Delay so that
+	// parallel downloads don't retry in lockstep
+	Jitter time.Duration
+	// Rand is the jitter source, e.g. rand.New(rand.NewSource(1)) for
+	// reproducible pauses. The global math/rand source is used when nil.
+	Rand *rand.Rand
+	// TickerRetries overrides MaxRetries for particular tickers
+	TickerRetries map[string]int
+	// TemporaryOnly retries network failures only when they are temporary,
+	// like timeouts, and gives up at once on permanent ones like unknown host
+	TemporaryOnly bool
+}
+
+// retries returns retries count for ticker
+func (p RetryPolicy) retries(ticker string) int {
+	if n, ok := p.TickerRetries[ticker]; ok {
+		return n
+	}
+	return p.MaxRetries
+}
+
+// statusError is returned for unsuccessful http responses
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "unexpected response status " + e.status
+}
+
+// StatusCode returns status of unsuccessful ISS response err was caused by,
+// false when err isn't caused by one, e.g. for network failures
+func StatusCode(err error) (int, bool) {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code, true
+	}
+	return 0, false
+}
+
+// retryable reports whether request failed with err is worth repeating
+func (p RetryPolicy) retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= http.StatusInternalServerError
+	}
+	if p.TemporaryOnly {
+		return temporary(err)
+	}
+	return true
+}
+
+// temporary reports whether err is a temporary network failure
+func temporary(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
+	}
+	return false
+}
+
+// get requests url repeating failed attempts according to retry policy
+func (f *Fetcher) get(ctx context.Context, ticker, url string) (*http.Response, error) {
+	retries := f.Retry.retries(ticker)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := f.do(ctx, url)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= retries || !f.Retry.retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		if err := sleep(ctx, f.retryDelay()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep pauses for d returning early with context error once ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryDelay returns pause before the next attempt with jitter applied
+func (f *Fetcher) retryDelay() time.Duration {
+	if f.Retry.Jitter <= 0 {
+		return f.Retry.Delay
+	}
+
+	n := int64(f.Retry.Jitter) + 1
+	if f.Retry.Rand == nil {
+		return f.Retry.Delay + time.Duration(rand.Int63n(n))
+	}
+
+	// rand.Rand isn't safe for concurrent use
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Retry.Delay + time.Duration(f.Retry.Rand.Int63n(n))
+}
+
+// do makes a single http request
+func (f *Fetcher) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create http request")
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	// Configured headers take precedence over the defaults
+	for name, values := range f.Headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	if f.BeforeRequest != nil {
+		f.BeforeRequest(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "http get")
+	}
+
+	if f.AfterResponse != nil {
+		f.AfterResponse(resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodedBody is a decompressing reader of response body
+type decodedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
+
+// decodeBody replaces gzip or deflate compressed response body with
+// decompressing reader, uncompressed bodies are left as is
+func decodeBody(resp *http.Response) error {
+	var reader io.ReadCloser
+	var err error
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		reader, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "decode response body")
+	}
+
+	resp.Body = decodedBody{ReadCloser: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
@@ -0,0 +1,250 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTickerRetriesOverride(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ticker := range []string{"SBER", "ILLQ"} {
+			if strings.Contains(r.URL.Path, "/securities/"+ticker+"/") {
+				attempts[ticker]++
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	fetcher.Retry = RetryPolicy{MaxRetries: 1, TickerRetries: map[string]int{"ILLQ": 4}}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, ticker := range []string{"SBER", "ILLQ"} {
+		if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", ticker, day, day, IntervalMinute1); err == nil {
+			t.Fatalf("%s: expected error", ticker)
+		}
+	}
+
+	if attempts["SBER"] != 2 {
+		t.Errorf("default ticker made %d attempts, want 2", attempts["SBER"])
+	}
+	if attempts["ILLQ"] != 5 {
+		t.Errorf("overridden ticker made %d attempts, want 5", attempts["ILLQ"])
+	}
+}
+
+// timeoutError is a temporary network failure
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryTemporaryOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"timeout", timeoutError{}, 3},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "iss.moex.com", IsNotFound: true}, 1},
+	}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		attempts := 0
+		fetcher := &Fetcher{
+			Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				attempts++
+				return nil, tt.err
+			})},
+			Retry: RetryPolicy{MaxRetries: 2, TemporaryOnly: true},
+		}
+
+		if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+		if attempts != tt.want {
+			t.Errorf("%s: made %d attempts, want %d", tt.name, attempts, tt.want)
+		}
+	}
+}
+
+func TestSeededRetryDelays(t *testing.T) {
+	delays := func(seed int64) []time.Duration {
+		fetcher := &Fetcher{Retry: RetryPolicy{
+			Delay:  time.Second,
+			Jitter: 500 * time.Millisecond,
+			Rand:   rand.New(rand.NewSource(seed)),
+		}}
+		result := make([]time.Duration, 4)
+		for i := range result {
+			result[i] = fetcher.retryDelay()
+		}
+		return result
+	}
+
+	got := delays(1)
+	want := []time.Duration{1293765849, 1232823140, 1407176623, 1160608479}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("delay %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	again := delays(1)
+	for i := range got {
+		if got[i] != again[i] {
+			t.Fatalf("same seed gave different delays %v and %v", got, again)
+		}
+	}
+
+	// No jitter means exact Delay
+	fetcher := &Fetcher{Retry: RetryPolicy{Delay: time.Second, Rand: rand.New(rand.NewSource(1))}}
+	if got := fetcher.retryDelay(); got != time.Second {
+		t.Errorf("got %s without jitter, want 1s", got)
+	}
+}
+
+// compressedCandles returns candles page and its encodings by Content-Encoding
+func compressedCandles(t *testing.T, data []OHLCV) map[string][]byte {
+	t.Helper()
+	rows := make([]string, 0, len(data))
+	for _, ohlc := range data {
+		rows = append(rows, candleRow(ohlc))
+	}
+	page := []byte(candlesCSV(candlesHeader, rows...))
+
+	compress := func(w io.WriteCloser, buf *bytes.Buffer) []byte {
+		if _, err := w.Write(page); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	var gz, deflate bytes.Buffer
+	return map[string][]byte{
+		"":        page,
+		"gzip":    compress(gzip.NewWriter(&gz), &gz),
+		"deflate": compress(zlib.NewWriter(&deflate), &deflate),
+	}
+}
+
+func TestFetchDecodesCompressedBody(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3)
+	for encoding, body := range compressedCandles(t, data) {
+		var accept string
+		fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+			accept = r.Header.Get("Accept-Encoding")
+			if encoding != "" {
+				w.Header().Set("Content-Encoding", encoding)
+			}
+			w.Write(body)
+		})
+
+		day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+		got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		if accept != "gzip, deflate" {
+			t.Errorf("%q: got Accept-Encoding %q", encoding, accept)
+		}
+		if len(got) != len(data) {
+			t.Fatalf("%q: got %d candles, want %d", encoding, len(got), len(data))
+		}
+		for i := range data {
+			if !got[i].Date.Equal(data[i].Date) || got[i].Close != data[i].Close || got[i].Volume != data[i].Volume {
+				t.Errorf("%q: candle %d: got %+v, want %+v", encoding, i, got[i], data[i])
+			}
+		}
+	}
+}
+
+func TestFetchCorruptCompressedBody(t *testing.T) {
+	gz := compressedCandles(t, minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 50))["gzip"]
+	for name, body := range map[string][]byte{
+		"not gzip":  []byte("candles\n"),
+		"truncated": gz[:len(gz)/2],
+	} {
+		fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(body)
+		})
+
+		day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+		got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		if err == nil {
+			t.Errorf("%s: got %d candles, want error", name, len(got))
+		}
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		headers   http.Header
+		want      http.Header
+	}{
+		{
+			name: "defaults",
+			want: http.Header{"User-Agent": {DefaultUserAgent}, "Accept-Encoding": {"gzip, deflate"}},
+		},
+		{
+			name:      "user agent",
+			userAgent: "research-bot/1.0",
+			headers:   http.Header{"X-Team": {"quant"}},
+			want:      http.Header{"User-Agent": {"research-bot/1.0"}, "X-Team": {"quant"}},
+		},
+		{
+			name:      "headers take precedence",
+			userAgent: "research-bot/1.0",
+			headers:   http.Header{"User-Agent": {"team-agent/2.0"}, "Accept-Encoding": {"identity"}},
+			want:      http.Header{"User-Agent": {"team-agent/2.0"}, "Accept-Encoding": {"identity"}},
+		},
+	}
+	for _, test := range tests {
+		var got http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			fmt.Fprint(w, candlesCSV(candlesHeader))
+		}))
+		fetcher := &Fetcher{
+			Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				r.URL.Scheme, r.URL.Host = "http", srv.Listener.Addr().String()
+				return http.DefaultTransport.RoundTrip(r)
+			})},
+			UserAgent: test.userAgent,
+			Headers:   test.headers,
+		}
+
+		day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+		_, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for name, values := range test.want {
+			if strings.Join(got.Values(name), ", ") != strings.Join(values, ", ") {
+				t.Errorf("%s: server got %s %q, want %q", test.name, name, got.Values(name), values)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaVersion identifies candles columns layout the parser is written for
+const SchemaVersion = "candles/v1"
+
+// expectedColumns are candles.csv columns of SchemaVersion
+var expectedColumns = []string{"open", "close", "high", "low", "value", "volume", "begin", "end"}
+
+// optionalColumns are columns sent for some markets only, like open
+// interest of forts, they are accepted by strict schema when present
+var optionalColumns = []string{"openoi", "closeoi"}
+
+// requiredColumns are columns candles can't be parsed without,
+// close column is configurable and checked separately
+var requiredColumns = []string{"begin", "open", "high", "low", "volume"}
+
+// SchemaError is returned when received candles header differs from the
+// expected schema, so a changed API fails loudly instead of being misparsed
+type SchemaError struct {
+	Version string
+	Added   []string
+	Removed []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("MOEX schema changed from %s: added columns [%s], removed columns [%s]",
+		e.Version, strings.Join(e.Added, ", "), strings.Join(e.Removed, ", "))
+}
+
+// schema is a resolved mapping of csv column names to their indexes
+type schema struct {
+	header  string
+	columns map[string]int
+}
+
+// resolveSchema returns column indexes for the header row, reusing
+// the schema cached for the endpoint while the header stays the same.
+// Header is validated against the expected schema once it changes.
+func (f *Fetcher) resolveSchema(key string, header []string) (map[string]int, error) {
+	joined := strings.Join(header, ";")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.schemas[key]; ok && s.header == joined {
+		return s.columns, nil
+	}
+
+	columns := make(map[string]int, len(header))
+	for indx, name := range header {
+		columns[name] = indx
+	}
+
+	if err := f.validateSchema(columns); err != nil {
+		return nil, err
+	}
+
+	if f.schemas == nil {
+		f.schemas = make(map[string]*schema)
+	}
+	f.schemas[key] = &schema{header: joined, columns: columns}
+
+	return columns, nil
+}
+
+// closeColumn returns name of the column mapped to OHLCV.Close
+func (f *Fetcher) closeColumn() string {
+	if f.CloseColumn == "" {
+		return "close"
+	}
+	return f.CloseColumn
+}
+
+// validateSchema compares received columns with the expected schema
+func (f *Fetcher) validateSchema(columns map[string]int) error {
+	expected := make(map[string]bool)
+	for _, name := range expectedColumns {
+		expected[name] = true
+	}
+	expected[f.closeColumn()] = true
+	optional := make(map[string]bool)
+	for _, name := range optionalColumns {
+		optional[name] = true
+	}
+
+	required := append([]string{f.closeColumn()}, requiredColumns...)
+
+	schemaErr := &SchemaError{Version: SchemaVersion}
+	if f.StrictSchema {
+		for name := range expected {
+			if _, ok := columns[name]; !ok {
+				schemaErr.Removed = append(schemaErr.Removed, name)
+			}
+		}
+		for name := range columns {
+			if !expected[name] && !optional[name] {
+				schemaErr.Added = append(schemaErr.Added, name)
+			}
+		}
+	} else {
+		for _, name := range required {
+			if _, ok := columns[name]; !ok {
+				schemaErr.Removed = append(schemaErr.Removed, name)
+			}
+		}
+	}
+
+	if len(schemaErr.Added) == 0 && len(schemaErr.Removed) == 0 {
+		return nil
+	}
+	sort.Strings(schemaErr.Added)
+	sort.Strings(schemaErr.Removed)
+	return schemaErr
+}
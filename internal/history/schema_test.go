@@ -0,0 +1,99 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchemaParsedOnceAcrossPages(t *testing.T) {
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), pageSize+20)
+	fetcher := newTestFetcher(servePages(data))
+
+	const key = "stock/shares/candles"
+	var resolved []*schema
+	fetcher.AfterResponse = func(*http.Response) {
+		fetcher.mu.Lock()
+		defer fetcher.mu.Unlock()
+		resolved = append(resolved, fetcher.schemas[key])
+	}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("got %d candles, want %d", len(got), len(data))
+	}
+
+	// Schema is resolved by the first page and reused by the second one
+	if len(resolved) != 2 || resolved[0] != nil || resolved[1] == nil {
+		t.Fatalf("unexpected schema cache states %v", resolved)
+	}
+	if fetcher.schemas[key] != resolved[1] {
+		t.Error("schema was parsed again for the second page")
+	}
+}
+
+func TestSchemaRevalidatedWhenHeaderChanges(t *testing.T) {
+	header := candlesHeader
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(header))
+	})
+	fetcher.StrictSchema = true
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1); err != nil {
+		t.Fatal(err)
+	}
+
+	header = candlesHeader + ";extra"
+	_, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("got %v, want SchemaError", err)
+	}
+}
+
+func TestSchemaErrorListsColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		strict  bool
+		added   string
+		removed string
+	}{
+		{"extra column", candlesHeader + ";extra", true, "extra", ""},
+		{"renamed column", strings.Replace(candlesHeader, "volume", "vol", 1), false, "", "volume"},
+		{"renamed strict column", strings.Replace(candlesHeader, "volume", "vol", 1), true, "vol", "volume"},
+	}
+
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, candlesCSV(tt.header, "1;1;1;1;0;1;2024-01-10 10:00:00;2024-01-10 10:00:59"))
+		})
+		fetcher.StrictSchema = tt.strict
+
+		_, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Errorf("%s: got %v, want SchemaError", tt.name, err)
+			continue
+		}
+		if got := strings.Join(schemaErr.Added, ","); got != tt.added {
+			t.Errorf("%s: got added %q, want %q", tt.name, got, tt.added)
+		}
+		if got := strings.Join(schemaErr.Removed, ","); got != tt.removed {
+			t.Errorf("%s: got removed %q, want %q", tt.name, got, tt.removed)
+		}
+		if !strings.Contains(err.Error(), "MOEX schema changed") {
+			t.Errorf("%s: got message %q", tt.name, err)
+		}
+	}
+}
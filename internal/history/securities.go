@@ -0,0 +1,87 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Security is a security traded on a board
+type Security struct {
+	SecID     string
+	ShortName string
+}
+
+// ListSecurities returns securities currently traded on engine market board
+func (f *Fetcher) ListSecurities(ctx context.Context, engine, market, board string) ([]Security, error) {
+	url := fmt.Sprintf("%s/engines/%s/markets/%s/boards/%s/securities.json?iss.meta=off&iss.only=securities&securities.columns=SECID,SHORTNAME",
+		issURL, engine, market, board)
+
+	tables, err := f.getTables(ctx, "", url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list securities of %s/%s/%s", engine, market, board)
+	}
+
+	var securities []Security
+	for _, row := range tables["securities"].rows() {
+		securities = append(securities, Security{
+			SecID:     cellString(row["SECID"]),
+			ShortName: cellString(row["SHORTNAME"]),
+		})
+	}
+	return securities, nil
+}
+
+// ValidateTickers returns error listing tickers not traded on engine market board
+func (f *Fetcher) ValidateTickers(ctx context.Context, engine, market, board string, tickers ...string) error {
+	securities, err := f.ListSecurities(ctx, engine, market, board)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(securities))
+	for _, security := range securities {
+		known[security.SecID] = true
+	}
+
+	var unknown []string
+	for _, ticker := range tickers {
+		if !known[ticker] {
+			unknown = append(unknown, ticker)
+		}
+	}
+	if len(unknown) > 0 {
+		return errors.Errorf("unknown tickers on board %s: %s", board, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// FirstCandleDate returns begin of the earliest interval candle of ticker
+// from ISS candle borders, e.g. to skip months before listing. Zero time is
+// returned when ISS has no candles of the interval.
+func (f *Fetcher) FirstCandleDate(
+	ctx context.Context, engine, market, board, ticker string, interval int,
+) (time.Time, error) {
+	url := fmt.Sprintf("%s/engines/%s/markets/%s/boards/%s/securities/%s/candleborders.json?iss.meta=off",
+		issURL, engine, market, board, ticker)
+
+	tables, err := f.getTables(ctx, ticker, url)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "get candle borders of %s", ticker)
+	}
+
+	for _, row := range tables["borders"].rows() {
+		if cellInt(row["interval"]) != interval {
+			continue
+		}
+		begin, err := time.ParseInLocation("2006-01-02 15:04:05", cellString(row["begin"]), f.location())
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "parse candle borders of %s", ticker)
+		}
+		return begin, nil
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,145 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveSecurities serves TQBR securities list with SBER and GAZP and counts
+// candles requests
+func serveSecurities(candles *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/boards/TQBR/securities.json") {
+			fmt.Fprint(w, `{"securities": {"columns": ["SECID", "SHORTNAME"], "data": [["SBER", "Сбербанк"], ["GAZP", "ГАЗПРОМ ао"]]}}`)
+			return
+		}
+		candles.Add(1)
+		servePages(nil)(w, r)
+	}
+}
+
+func TestValidateTickers(t *testing.T) {
+	var candles atomic.Int32
+	fetcher := newTestFetcher(serveSecurities(&candles))
+
+	if err := fetcher.ValidateTickers(context.Background(), "stock", "shares", "TQBR", "SBER", "GAZP"); err != nil {
+		t.Errorf("got error %v for known tickers", err)
+	}
+	err := fetcher.ValidateTickers(context.Background(), "stock", "shares", "TQBR", "SBER", "NOPE", "GAZP", "MISS")
+	if err == nil || !strings.Contains(err.Error(), "NOPE, MISS") || strings.Contains(err.Error(), "SBER") {
+		t.Errorf("got error %v, want NOPE and MISS listed", err)
+	}
+}
+
+func TestProcessSharesValidatesFirst(t *testing.T) {
+	var candles atomic.Int32
+	fetcher := newTestFetcher(serveSecurities(&candles))
+
+	dir := t.TempDir()
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, Validate: true}
+	_, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER", "NOPE")
+	if err == nil || !strings.Contains(err.Error(), "NOPE") {
+		t.Fatalf("got error %v, want NOPE reported", err)
+	}
+	if candles.Load() != 0 {
+		t.Errorf("got %d candles requests before validation failed", candles.Load())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files written", len(entries))
+	}
+}
+
+// candleBorders is ISS candleborders.json response of a share listed in May 2023
+const candleBorders = `{"borders": {
+	"columns": ["begin", "end", "interval", "board_group_id"],
+	"data": [
+		["2023-05-15 10:00:00", "2024-01-10 18:39:00", 1, 57],
+		["2023-05-15 10:00:00", "2024-01-10 18:30:00", 10, 57],
+		["2023-05-12 00:00:00", "2024-01-10 00:00:00", 24, 57]
+	]
+}}`
+
+func TestFirstCandleDate(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candleBorders)
+	})
+
+	for interval, want := range map[int]time.Time{
+		IntervalMinute1:  moscowTime(2023, 5, 15, 10, 0),
+		IntervalMinute10: moscowTime(2023, 5, 15, 10, 0),
+		IntervalDay:      moscowTime(2023, 5, 12, 0, 0),
+		// No candles of the interval
+		IntervalHour: {},
+	} {
+		got, err := fetcher.FirstCandleDate(context.Background(), "stock", "shares", "TQBR", "NEWS", interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("interval %d: got %s, want %s", interval, got, want)
+		}
+	}
+}
+
+func TestFirstCandleDateMalformed(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"borders": {"columns": ["begin", "interval"], "data": [["15.05.2023", 1]]}}`)
+	})
+	if _, err := fetcher.FirstCandleDate(context.Background(), "stock", "shares", "TQBR", "NEWS", IntervalMinute1); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestClampToFirstCandleSkipsMonths(t *testing.T) {
+	var months []string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/candleborders.json") {
+			fmt.Fprint(w, candleBorders)
+			return
+		}
+		months = append(months, r.URL.Query().Get("from")[:7])
+		servePages(nil)(w, r)
+	})
+
+	opts := ProcessOptions{
+		OutputDir: t.TempDir(), Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1,
+		ClampToFirstCandle: true,
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "NEWS"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"2023-05", "2023-06", "2023-07", "2023-08", "2023-09", "2023-10", "2023-11", "2023-12"}
+	if strings.Join(months, ",") != strings.Join(want, ",") {
+		t.Errorf("got months %v, want %v", months, want)
+	}
+}
+
+func TestFirstTradeDatesSkipMonths(t *testing.T) {
+	var months []string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/candleborders.json") {
+			t.Error("requested candle borders of share with known first trade date")
+		}
+		months = append(months, r.URL.Query().Get("from")[:7])
+		servePages(nil)(w, r)
+	})
+
+	opts := ProcessOptions{
+		OutputDir: t.TempDir(), Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1,
+		ClampToFirstCandle: true,
+		FirstTradeDates:    map[string]time.Time{"NEWS": time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "NEWS"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(months, ",") != "2023-11,2023-12" {
+		t.Errorf("got months %v, want 2023-11 and 2023-12", months)
+	}
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"context"
+	"time"
+)
+
+// ISS trading sessions passed in tradingsession parameter
+const (
+	SessionMorning = "0"
+	SessionMain    = "1"
+	SessionEvening = "2"
+)
+
+// FetchSessions fetches candles of every trading session separately, main and
+// evening by default, and merges them into a single continuous series sorted
+// by Date. Bars present in several sessions responses are kept once.
+func (f *Fetcher) FetchSessions(
+	ctx context.Context, engine, market, board, ticker string, startDate, endDate time.Time, interval int,
+	sessions ...string,
+) ([]OHLCV, error) {
+	if len(sessions) == 0 {
+		sessions = []string{SessionMain, SessionEvening}
+	}
+
+	var result []OHLCV
+	for _, session := range sessions {
+		err := f.stream(ctx, candlesRequest{
+			engine:    engine,
+			market:    market,
+			board:     board,
+			ticker:    ticker,
+			startDate: startDate,
+			endDate:   endDate,
+			interval:  interval,
+			session:   session,
+		}, func(ohlc OHLCV) error {
+			result = append(result, ohlc)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Dedup(result), nil
+}
+
+// sessionStart returns beginning of the trading session running at now,
+// that is midnight of the current calendar date in location
+func sessionStart(now time.Time, location *time.Location) time.Time {
+	now = now.In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}
@@ -0,0 +1,42 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchSessionsMerges(t *testing.T) {
+	mainBars := minuteCandles("Si", moscowTime(2024, 3, 14, 18, 48), 3)
+	// Evening session repeats the last main bar
+	eveningBars := minuteCandles("Si", moscowTime(2024, 3, 14, 18, 50), 3)
+	sessions := map[string][]OHLCV{SessionMain: mainBars, SessionEvening: eveningBars}
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := sessions[r.URL.Query().Get("tradingsession")]
+		if !ok {
+			t.Errorf("unexpected session of %s", r.URL)
+		}
+		// Sessions answer in reverse order to check merging sorts them
+		reversed := make([]OHLCV, len(data))
+		for i := range data {
+			reversed[len(data)-1-i] = data[i]
+		}
+		servePages(reversed)(w, r)
+	})
+
+	day := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	got, err := fetcher.FetchSessions(context.Background(), "futures", "forts", "RFUD", "SiH4", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("got %d candles, want 5: %v", len(got), dates(got))
+	}
+	for i, date := range dates(got) {
+		if want := moscowTime(2024, 3, 14, 18, 48+i); !date.Equal(want) {
+			t.Errorf("candle %d at %s, want %s", i, date, want)
+		}
+	}
+}
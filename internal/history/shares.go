@@ -0,0 +1,204 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Shares market coordinates on MOEX ISS
+const (
+	SharesEngine = "stock"
+	SharesMarket = "shares"
+	SharesBoard  = "TQBR"
+)
+
+// ProcessShares downloads shares month by month for given year range,
+// every share is written into its own file. Failed shares don't stop others
+// unless FailFast is set, their errors are joined into the returned error.
+func ProcessShares(
+	ctx context.Context, fetcher *Fetcher, opts ProcessOptions, yearStart, yearEnd int, stocks ...string,
+) (*Report, error) {
+	opts = opts.withIntervalLayout().withFetcherLocation(fetcher)
+
+	if opts.Validate {
+		engine, market, board := opts.coordinates(SharesEngine, SharesMarket, SharesBoard)
+		if err := fetcher.ValidateTickers(ctx, engine, market, board, stocks...); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := outputDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	started := time.Now()
+
+	runCtx, cancel := opts.withMaxRuntime(ctx)
+	defer cancel()
+
+	gr, ctx := errgroup.WithContext(runCtx)
+	gr.SetLimit(NormalizeConcurrency(opts.Concurrency)) // Limit concurrent requests
+
+	for _, stock := range stocks {
+		gr.Go(func() error {
+			return track(opts, report, stock, func() (TickerResult, error) {
+				return processShare(ctx, fetcher, opts, dir, stock, yearStart, yearEnd)
+			})
+		})
+	}
+
+	return report, finishRun(runCtx, opts, dir, report, started, gr.Wait())
+}
+
+// processShare downloads a single share into its file. Unless Force is set
+// data is written into a temporary file which replaces the existing one
+// only after all months succeed.
+func processShare(
+	ctx context.Context, fetcher *Fetcher, opts ProcessOptions, dir, stock string, yearStart, yearEnd int,
+) (TickerResult, error) {
+	result := TickerResult{Ticker: stock}
+	engine, market, board := opts.coordinates(SharesEngine, SharesMarket, SharesBoard)
+
+	fileName, err := outputPath(dir, opts, pathVars{ticker: stock, board: board, year: yearStart})
+	if err != nil {
+		return result, err
+	}
+	result.FileName = fileName
+
+	// Resume from the last complete row already written. It is replaced as it
+	// may hold a bar of a session unfinished by the time of the last run,
+	// unless it precedes the requested years and wouldn't be fetched again.
+	incremental := opts.Incremental && !opts.Gzip && opts.Storer == nil && opts.Adjustments == nil
+	var resumeDate, lastDate time.Time
+	keep := int64(-1)
+	if incremental {
+		var rowEnd int64
+		if resumeDate, keep, rowEnd, err = resumePoint(fileName, opts.Writer); err != nil {
+			return result, fmt.Errorf("failed to resume %s: %w", fileName, err)
+		}
+		lastDate = resumeDate.Add(-time.Nanosecond)
+		if resumeDate.Year() < yearStart {
+			keep, lastDate = rowEnd, resumeDate
+		}
+	}
+
+	firstTrade, trimmed := opts.FirstTradeDates[stock]
+	if !trimmed && opts.ClampToFirstCandle {
+		first, err := fetcher.FirstCandleDate(ctx, engine, market, board, stock, opts.Interval)
+		if err != nil {
+			return result, fmt.Errorf("failed to get first candle date of %s: %w", stock, err)
+		}
+		// Month end dates are compared with the first trading day
+		firstTrade = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+		trimmed = !first.IsZero()
+	}
+
+	var file sink
+	if !opts.DryRun {
+		if file, err = createSink(stock, fileName, opts, keep); err != nil {
+			return result, fmt.Errorf("failed to create/open file for %s: %w", stock, err)
+		}
+	}
+
+	gaps := &coverage{interval: opts.Interval}
+
+	var adjustments []Adjustment
+	if opts.Adjustments != nil && !opts.DryRun {
+		if adjustments, err = opts.Adjustments(ctx, stock); err != nil {
+			file.abort()
+			return result, fmt.Errorf("failed to get adjustments of %s: %w", stock, err)
+		}
+	}
+
+	for year := yearStart; year <= yearEnd; year++ {
+		for month := 1; month <= 12; month++ {
+			startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			endDate := startDate.AddDate(0, 1, -1)
+
+			// Skip future months
+			if startDate.After(time.Now()) {
+				continue
+			}
+
+			// Skip months before the first trade
+			if trimmed && endDate.Before(firstTrade) {
+				continue
+			}
+
+			// Skip months already downloaded
+			if endDate.AddDate(0, 0, 1).Before(resumeDate) {
+				continue
+			}
+			// Resume partially downloaded month from the replaced candle
+			if resumeDate.After(startDate) {
+				startDate = resumeDate
+			}
+
+			if opts.DryRun {
+				planRequest(opts, &result, fetcher.CandlesURL(engine, market, board, stock, startDate, endDate, opts.Interval), fileName)
+				continue
+			}
+
+			data, err := fetcher.Fetch(ctx, engine, market, board, stock, startDate, endDate, opts.Interval)
+			if err != nil {
+				file.abort()
+				return result, fmt.Errorf("failed to get OHLC data for %s %d-%02d: %w", stock, year, month, err)
+			}
+
+			// Skip candles already written at month boundaries
+			data = After(Dedup(data), lastDate)
+			data = FilterVolume(data, opts.MinVolume)
+			if opts.Adjustments != nil {
+				Adjust(data, adjustments)
+			}
+
+			if len(data) > 0 {
+				if err := file.write(data); err != nil {
+					file.abort()
+					return result, fmt.Errorf("failed to write data to file: %w", err)
+				}
+				if opts.CommitPerPeriod {
+					if err := file.checkpoint(); err != nil {
+						file.abort()
+						return result, err
+					}
+				}
+				lastDate = data[len(data)-1].Date
+				result.Rows += len(data)
+				gaps.add(data)
+				opts.LogLevel.logf(LogDebug, "Successfully wrote %d records for %s %d-%02d", len(data), stock, year, month)
+			} else {
+				opts.LogLevel.logf(LogDebug, "No data for %s %d-%02d", stock, year, month)
+			}
+
+			// Small delay to avoid overwhelming the API
+			if delay := opts.requestDelay(); delay > 0 {
+				if err := sleep(ctx, delay); err != nil {
+					file.abort()
+					return result, err
+				}
+			}
+		}
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	result.UnderCovered = result.Rows < opts.MinBars
+	gaps.report(&result)
+
+	if err := file.commit(opts); err != nil {
+		return result, err
+	}
+
+	if opts.WriteCoverage {
+		return result, gaps.write(fileName, opts.Writer)
+	}
+	return result, nil
+}
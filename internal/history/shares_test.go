@@ -0,0 +1,44 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFirstTradeDateSkipsMonths(t *testing.T) {
+	var mu sync.Mutex
+	var months []string
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		months = append(months, r.URL.Query().Get("from")[:7])
+		mu.Unlock()
+		servePages(nil)(w, r)
+	})
+
+	opts := ProcessOptions{
+		OutputDir:       t.TempDir(),
+		Writer:          DefaultWriter(),
+		Interval:        IntervalMinute1,
+		RequestDelay:    -1,
+		FirstTradeDates: map[string]time.Time{"IPO": time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "IPO"); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(months)
+	want := []string{"2023-10", "2023-11", "2023-12"}
+	if len(months) != len(want) {
+		t.Fatalf("requested months %v, want %v", months, want)
+	}
+	for i := range want {
+		if months[i] != want[i] {
+			t.Errorf("requested months %v, want %v", months, want)
+			break
+		}
+	}
+}
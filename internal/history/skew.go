@@ -0,0 +1,44 @@
+package history
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClockSkew returns difference between local clock and ISS server time
+// taken from the Date header of a lightweight ISS response.
+// Positive value means local clock is ahead of the server.
+func (f *Fetcher) ClockSkew(ctx context.Context) (time.Duration, error) {
+	resp, err := f.get(ctx, "", issURL+"/engines.csv")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, errors.Wrap(err, "parse server date header")
+	}
+
+	return time.Since(serverTime), nil
+}
+
+// CheckClockSkew prints a warning at LogInfo level when local clock differs
+// from ISS server time by more than threshold. Future periods are skipped
+// using local clock, so a badly skewed clock makes long runs miss or request
+// wrong periods.
+func (f *Fetcher) CheckClockSkew(ctx context.Context, threshold time.Duration) (time.Duration, error) {
+	skew, err := f.ClockSkew(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if skew > threshold || skew < -threshold {
+		f.LogLevel.logf(LogInfo, "Warning: local clock differs from ISS server time by %s", skew.Round(time.Second))
+	}
+
+	return skew, nil
+}
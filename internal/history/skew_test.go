@@ -0,0 +1,89 @@
+package history
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns everything fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// serveDate answers every request with the Date header of serverTime
+func serveDate(serverTime time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	// Server is ten minutes behind local clock
+	fetcher := newTestFetcher(serveDate(time.Now().Add(-10 * time.Minute)))
+	fetcher.LogLevel = LogInfo
+
+	var skew time.Duration
+	var err error
+	out := captureStdout(t, func() {
+		skew, err = fetcher.CheckClockSkew(context.Background(), time.Minute)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skew < 9*time.Minute || skew > 11*time.Minute {
+		t.Errorf("got skew %s, want about 10m", skew)
+	}
+	if !strings.Contains(out, "Warning: local clock differs") {
+		t.Errorf("got output %q, want a warning", out)
+	}
+
+	fetcher.LogLevel = LogSilent
+	out = captureStdout(t, func() {
+		fetcher.CheckClockSkew(context.Background(), time.Minute)
+	})
+	if out != "" {
+		t.Errorf("got output %q with LogSilent level", out)
+	}
+}
+
+func TestCheckClockSkewWithinThreshold(t *testing.T) {
+	fetcher := newTestFetcher(serveDate(time.Now()))
+	fetcher.LogLevel = LogInfo
+
+	out := captureStdout(t, func() {
+		if _, err := fetcher.CheckClockSkew(context.Background(), time.Minute); err != nil {
+			t.Error(err)
+		}
+	})
+	if out != "" {
+		t.Errorf("got output %q, want no warning", out)
+	}
+}
+
+func TestClockSkewWithoutDateHeader(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := fetcher.ClockSkew(context.Background()); err == nil {
+		t.Error("expected error of missing Date header")
+	}
+}
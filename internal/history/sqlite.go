@@ -0,0 +1,74 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SQLiteStorer upserts candles into SQLite candles table with unique
+// (ticker, date) index, so re-runs update rows instead of duplicating them.
+// Dates are stored as UTC "YYYY-MM-DD HH:MM:SS" text understood by SQLite
+// date functions. Database is opened by the caller with a SQLite driver of
+// choice, e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3, which the
+// caller imports to register it. The command line tool links no driver.
+type SQLiteStorer struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorer creates candles table and index when they don't exist
+func NewSQLiteStorer(db *sql.DB) (*SQLiteStorer, error) {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS candles (
+			ticker TEXT NOT NULL,
+			date TEXT NOT NULL,
+			open REAL NOT NULL,
+			high REAL NOT NULL,
+			low REAL NOT NULL,
+			close REAL NOT NULL,
+			volume INTEGER NOT NULL
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS candles_ticker_date ON candles (ticker, date)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, errors.Wrap(err, "create candles table")
+		}
+	}
+
+	return &SQLiteStorer{db: db}, nil
+}
+
+// Write upserts candles of ticker in a single transaction
+func (s *SQLiteStorer) Write(ticker string, data []OHLCV) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO candles (ticker, date, open, high, low, close, volume)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (ticker, date) DO UPDATE SET
+			open = excluded.open,
+			high = excluded.high,
+			low = excluded.low,
+			close = excluded.close,
+			volume = excluded.volume`)
+	if err != nil {
+		return errors.Wrap(err, "prepare upsert")
+	}
+	defer stmt.Close()
+
+	for _, ohlc := range data {
+		_, err := stmt.Exec(ticker, ohlc.Date.UTC().Format("2006-01-02 15:04:05"),
+			ohlc.Open, ohlc.High, ohlc.Low, ohlc.Close, ohlc.Volume)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("upsert %s candle", ticker))
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
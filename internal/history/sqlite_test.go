@@ -0,0 +1,191 @@
+package history
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSQLite is a database/sql driver emulating candles table of SQLite:
+// the unique (ticker, date) index and the upsert of SQLiteStorer
+type fakeSQLite struct {
+	mu      sync.Mutex
+	dbs     map[string]*fakeDB
+	failing string
+}
+
+// fakeDB is a database of fakeSQLite
+type fakeDB struct {
+	table bool
+	index bool
+	rows  map[[2]string][]driver.Value
+}
+
+var sqliteDriver = &fakeSQLite{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("fakesqlite", sqliteDriver)
+}
+
+func (d *fakeSQLite) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs[name] == nil {
+		d.dbs[name] = &fakeDB{rows: make(map[[2]string][]driver.Value)}
+	}
+	return &fakeConn{driver: d, db: d.dbs[name]}, nil
+}
+
+// fakeConn is a connection keeping rows of the current transaction
+type fakeConn struct {
+	driver  *fakeSQLite
+	db      *fakeDB
+	pending map[[2]string][]driver.Value
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[[2]string][]driver.Value)
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	for key, row := range c.pending {
+		c.db.rows[key] = row
+	}
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+// fakeStmt executes CREATE and INSERT statements of SQLiteStorer
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db := s.conn.db
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS candles"):
+		db.table = true
+	case strings.HasPrefix(s.query, "CREATE UNIQUE INDEX IF NOT EXISTS candles_ticker_date ON candles (ticker, date)"):
+		db.index = db.table
+	case strings.HasPrefix(s.query, "INSERT INTO candles"):
+		if !db.table {
+			return nil, fmt.Errorf("no such table: candles")
+		}
+		if len(args) != 7 {
+			return nil, fmt.Errorf("got %d arguments, want 7", len(args))
+		}
+		if args[0] == d.failing {
+			return nil, fmt.Errorf("disk I/O error")
+		}
+		key := [2]string{args[0].(string), args[1].(string)}
+		_, exists := db.rows[key]
+		if _, ok := s.conn.pending[key]; ok {
+			exists = true
+		}
+		if exists && (!db.index || !strings.Contains(s.query, "ON CONFLICT (ticker, date) DO UPDATE")) {
+			return nil, fmt.Errorf("UNIQUE constraint failed: candles.ticker, candles.date")
+		}
+		if s.conn.pending != nil {
+			s.conn.pending[key] = args
+		} else {
+			db.rows[key] = args
+		}
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, io.EOF
+}
+
+// openFakeSQLite opens new database of the fake driver
+func openFakeSQLite(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	db, err := sql.Open("fakesqlite", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	return db, sqliteDriver.dbs[t.Name()]
+}
+
+func TestSQLiteStorerUpserts(t *testing.T) {
+	db, fake := openFakeSQLite(t)
+	storer, err := NewSQLiteStorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fake.table || !fake.index {
+		t.Fatal("candles table or its unique index isn't created")
+	}
+
+	data := minuteCandles("SBER", moscowTime(2024, 1, 10, 10, 0), 3)
+	if err := storer.Write("SBER", data[:2]); err != nil {
+		t.Fatal(err)
+	}
+	// Re-run updates overlapping candle and adds the new one
+	data[1].Close = 999
+	if err := storer.Write("SBER", data[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(fake.rows))
+	}
+	// Dates are stored in UTC, MSK is UTC+3
+	row, ok := fake.rows[[2]string{"SBER", "2024-01-10 07:01:00"}]
+	if !ok {
+		t.Fatalf("row of the second candle isn't found in %v", fake.rows)
+	}
+	if row[5] != 999.0 {
+		t.Errorf("got close %v, want updated 999", row[5])
+	}
+}
+
+func TestSQLiteStorerRollsBackFailedBatch(t *testing.T) {
+	db, fake := openFakeSQLite(t)
+	storer, err := NewSQLiteStorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqliteDriver.failing = "ILLQ"
+	defer func() { sqliteDriver.failing = "" }()
+	if err := storer.Write("ILLQ", minuteCandles("ILLQ", moscowTime(2024, 1, 10, 10, 0), 2)); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(fake.rows) != 0 {
+		t.Errorf("got %d rows of failed batch", len(fake.rows))
+	}
+}
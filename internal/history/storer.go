@@ -0,0 +1,125 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storer persists fetched candles of instruments, it decouples
+// downloading from the output backend
+type Storer interface {
+	// Write stores a batch of ticker candles, it is called
+	// concurrently for different tickers
+	Write(ticker string, data []OHLCV) error
+}
+
+// FileStorer appends candles into <Dir>/<ticker>.txt files using Writer layout,
+// header is written when a file is created
+type FileStorer struct {
+	Dir    string
+	Writer Writer
+}
+
+// Write appends candles into ticker file
+func (s *FileStorer) Write(ticker string, data []OHLCV) error {
+	fileName := filepath.Join(s.Dir, fmt.Sprintf("%s.txt", ticker))
+
+	_, statErr := os.Stat(fileName)
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file for %s: %w", ticker, err)
+	}
+	defer file.Close()
+
+	if os.IsNotExist(statErr) {
+		if err := s.Writer.WriteHeaderTo(file); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+
+	if err := s.Writer.WriteRows(file, data); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return file.Close()
+}
+
+// MemoryStorer keeps candles in memory, it is handy for tests and
+// for embedding the processors into other programs
+type MemoryStorer struct {
+	mu   sync.Mutex
+	data map[string][]OHLCV
+}
+
+// Write appends candles of ticker
+func (s *MemoryStorer) Write(ticker string, data []OHLCV) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data == nil {
+		s.data = make(map[string][]OHLCV)
+	}
+	s.data[ticker] = append(s.data[ticker], data...)
+	return nil
+}
+
+// Candles returns candles stored for ticker
+func (s *MemoryStorer) Candles(ticker string) []OHLCV {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[ticker]
+}
+
+// MultiStorer passes candles to all its storers, e.g. into files and a database
+// in one pass. Every storer receives all candles even if others fail.
+type MultiStorer []Storer
+
+// Write passes candles of ticker to all storers joining their errors
+func (s MultiStorer) Write(ticker string, data []OHLCV) error {
+	var errs []error
+	for _, storer := range s {
+		if err := storer.Write(ticker, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes storers implementing io.Closer joining their errors
+func (s MultiStorer) Close() error {
+	var errs []error
+	for _, storer := range s {
+		if closer, ok := storer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// storerSink passes instrument candles to Storer
+type storerSink struct {
+	storer Storer
+	ticker string
+}
+
+func (s storerSink) write(data []OHLCV) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return s.storer.Write(s.ticker, data)
+}
+
+func (s storerSink) checkpoint() error {
+	return nil
+}
+
+func (s storerSink) commit(ProcessOptions) error {
+	return nil
+}
+
+func (s storerSink) abort() {}
@@ -0,0 +1,59 @@
+package history
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeStorer records written candles and fails writes and close with err
+type fakeStorer struct {
+	mu     sync.Mutex
+	rows   map[string]int
+	err    error
+	closed bool
+}
+
+func (s *fakeStorer) Write(ticker string, data []OHLCV) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rows == nil {
+		s.rows = make(map[string]int)
+	}
+	s.rows[ticker] += len(data)
+	return s.err
+}
+
+func (s *fakeStorer) Close() error {
+	s.closed = true
+	return s.err
+}
+
+func TestMultiStorer(t *testing.T) {
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+	first := &fakeStorer{err: errFirst}
+	second := &fakeStorer{err: errSecond}
+	multi := MultiStorer{first, second}
+
+	begin := moscowTime(2024, 1, 10, 10, 0)
+	err := multi.Write("SBER", minuteCandles("SBER", begin, 3))
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("got %v, want both errors joined", err)
+	}
+	multi.Write("GAZP", minuteCandles("GAZP", begin, 2))
+
+	for i, storer := range []*fakeStorer{first, second} {
+		if storer.rows["SBER"] != 3 || storer.rows["GAZP"] != 2 {
+			t.Errorf("storer %d got rows %v despite failures", i, storer.rows)
+		}
+	}
+
+	err = multi.Close()
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("got close error %v, want both errors joined", err)
+	}
+	if !first.closed || !second.closed {
+		t.Error("not all storers are closed")
+	}
+}
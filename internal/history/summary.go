@@ -0,0 +1,81 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// summaryFileName is the run summary file written with WriteSummary
+const summaryFileName = "summary.json"
+
+// runSummary is the layout of summary.json
+type runSummary struct {
+	Elapsed  string          `json:"elapsed"`
+	Seconds  float64         `json:"elapsed_seconds"`
+	Rows     int             `json:"rows"`
+	Failures int             `json:"failures"`
+	Tickers  []tickerSummary `json:"tickers"`
+}
+
+type tickerSummary struct {
+	Ticker       string       `json:"ticker"`
+	FileName     string       `json:"file,omitempty"`
+	Rows         int          `json:"rows"`
+	First        *time.Time   `json:"first,omitempty"`
+	Last         *time.Time   `json:"last,omitempty"`
+	Gaps         []gapSummary `json:"gaps"`
+	UnderCovered bool         `json:"under_covered"`
+	Seconds      float64      `json:"elapsed_seconds"`
+	Error        string       `json:"error,omitempty"`
+}
+
+type gapSummary struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Missing int       `json:"missing"`
+}
+
+// WriteSummary writes run summary JSON file with per ticker row counts,
+// dates range, gaps and errors along with totals and run duration
+func (r *Report) WriteSummary(fileName string) error {
+	r.mu.Lock()
+	summary := runSummary{
+		Elapsed: r.Elapsed.Round(time.Millisecond).String(),
+		Seconds: r.Elapsed.Seconds(),
+		Tickers: make([]tickerSummary, 0, len(r.Results)),
+	}
+	for _, result := range r.Results {
+		ticker := tickerSummary{
+			Ticker:       result.Ticker,
+			FileName:     result.FileName,
+			Rows:         result.Rows,
+			Gaps:         make([]gapSummary, 0, len(result.Gaps)),
+			UnderCovered: result.UnderCovered,
+			Seconds:      result.Elapsed.Seconds(),
+		}
+		if !result.First.IsZero() {
+			ticker.First, ticker.Last = &result.First, &result.Last
+		}
+		for _, gap := range result.Gaps {
+			ticker.Gaps = append(ticker.Gaps, gapSummary{Start: gap.Start, End: gap.End, Missing: gap.Missing})
+		}
+		if result.Err != nil {
+			ticker.Error = result.Err.Error()
+			summary.Failures++
+		}
+		summary.Rows += result.Rows
+		summary.Tickers = append(summary.Tickers, ticker)
+	}
+	r.mu.Unlock()
+
+	content, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
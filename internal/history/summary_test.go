@@ -0,0 +1,77 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSummary(t *testing.T) {
+	sber := minuteCandles("SBER", moscowTime(2023, 1, 10, 10, 0), 3)
+	// Two minutes are missing before the last SBER candle
+	sber[2].Date = moscowTime(2023, 1, 10, 10, 4)
+	gazp := minuteCandles("GAZP", moscowTime(2023, 1, 11, 10, 0), 2)
+
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Query().Get("from"), "2023-01") {
+			servePages(nil)(w, r)
+			return
+		}
+		switch {
+		case strings.Contains(r.URL.Path, "/SBER/"):
+			servePages(sber)(w, r)
+		case strings.Contains(r.URL.Path, "/GAZP/"):
+			servePages(gazp)(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	dir := t.TempDir()
+	opts := ProcessOptions{OutputDir: dir, Writer: DefaultWriter(), Interval: IntervalMinute1, RequestDelay: -1, WriteSummary: true}
+	if _, err := ProcessShares(context.Background(), fetcher, opts, 2023, 2023, "SBER", "GAZP", "LKOH"); err == nil {
+		t.Fatal("expected LKOH error")
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary runSummary
+	if err := json.Unmarshal(content, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Rows != 5 || summary.Failures != 1 || len(summary.Tickers) != 3 {
+		t.Fatalf("got %d rows, %d failures, %d tickers, want 5, 1, 3", summary.Rows, summary.Failures, len(summary.Tickers))
+	}
+	tickers := make(map[string]tickerSummary)
+	for _, ticker := range summary.Tickers {
+		tickers[ticker.Ticker] = ticker
+	}
+
+	check := func(name string, rows int, first, last time.Time, gaps int) {
+		t.Helper()
+		ticker := tickers[name]
+		if ticker.Rows != rows || ticker.Error != "" || len(ticker.Gaps) != gaps {
+			t.Errorf("%s: got %+v", name, ticker)
+		}
+		if ticker.First == nil || !ticker.First.Equal(first) || ticker.Last == nil || !ticker.Last.Equal(last) {
+			t.Errorf("%s: got dates %v - %v, want %s - %s", name, ticker.First, ticker.Last, first, last)
+		}
+	}
+	check("SBER", 3, sber[0].Date, sber[2].Date, 1)
+	check("GAZP", 2, gazp[0].Date, gazp[1].Date, 0)
+
+	if gap := tickers["SBER"].Gaps; len(gap) == 1 && (gap[0].Missing != 2 || !gap[0].Start.Equal(moscowTime(2023, 1, 10, 10, 2))) {
+		t.Errorf("got SBER gap %+v", gap[0])
+	}
+	if lkoh := tickers["LKOH"]; lkoh.Error == "" || lkoh.Rows != 0 || lkoh.First != nil {
+		t.Errorf("LKOH: got %+v, want error without rows", lkoh)
+	}
+}
@@ -0,0 +1,83 @@
+package history
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// typicalPrice returns (high+low+close)/3 used as a candle price for VWAP
+func typicalPrice(ohlc OHLCV) float64 {
+	return (ohlc.High + ohlc.Low + ohlc.Close) / 3
+}
+
+// SessionVWAP returns cumulative volume weighted average price for every
+// candle, sum(price*vol)/sum(vol) where price is the typical candle price.
+// Accumulation resets at session boundary, that is the candle calendar date.
+// Until the session has any volume the typical price is returned.
+func SessionVWAP(data []OHLCV) []float64 {
+	result := make([]float64, len(data))
+
+	var session vwapSession
+	for i, ohlc := range data {
+		result[i] = session.add(ohlc)
+	}
+	return result
+}
+
+// vwapSession accumulates VWAP of the current session across candles
+// written in several calls, e.g. month by month into one file
+type vwapSession struct {
+	// last is the previous candle, zero before the first one
+	last OHLCV
+	pv   float64
+	vol  int64
+}
+
+// add accumulates candle and returns session VWAP at it, see SessionVWAP
+func (s *vwapSession) add(ohlc OHLCV) float64 {
+	if !s.last.Date.IsZero() && !sameDay(s.last, ohlc) {
+		s.pv, s.vol = 0, 0
+	}
+	s.last = ohlc
+
+	s.pv += typicalPrice(ohlc) * float64(ohlc.Volume)
+	s.vol += ohlc.Volume
+
+	if s.vol == 0 {
+		return typicalPrice(ohlc)
+	}
+	return s.pv / float64(s.vol)
+}
+
+// resumeVWAP returns session accumulated over rows of candles file written
+// with w layout, so VWAP of appended rows includes rows of their session
+// written by a previous run. The first size bytes of the file are read.
+func resumeVWAP(fileName string, w Writer, size int64) (*vwapSession, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	session := &vwapSession{}
+	scanner := bufio.NewScanner(io.LimitReader(file, size))
+	for header := w.WriteHeader; scanner.Scan(); header = false {
+		if header || scanner.Text() == "" {
+			continue
+		}
+		ohlc, err := w.parseRow(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		session.add(ohlc)
+	}
+	return session, scanner.Err()
+}
+
+// sameDay reports whether candles belong to the same calendar date
+func sameDay(a, b OHLCV) bool {
+	ay, am, ad := a.Date.Date()
+	by, bm, bd := b.Date.In(a.Date.Location()).Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vwapCandles returns two candles of the first session and one of the next
+func vwapCandles() []OHLCV {
+	return []OHLCV{
+		{Date: moscowTime(2024, 1, 10, 10, 0), High: 12, Low: 9, Close: 9, Volume: 10},
+		{Date: moscowTime(2024, 1, 10, 10, 1), High: 15, Low: 12, Close: 15, Volume: 30},
+		{Date: moscowTime(2024, 1, 11, 10, 0), High: 21, Low: 18, Close: 21, Volume: 5},
+	}
+}
+
+func TestSessionVWAP(t *testing.T) {
+	got := SessionVWAP(vwapCandles())
+
+	// Typical prices are 10, 14 and 20
+	want := []float64{
+		10,
+		(10*10 + 14*30) / 40.0,
+		// New session starts over
+		20,
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("candle %d: got VWAP %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSessionVWAPWithoutVolume(t *testing.T) {
+	data := []OHLCV{{Date: moscowTime(2024, 1, 10, 10, 0), High: 12, Low: 9, Close: 9}}
+	if got := SessionVWAP(data); got[0] != 10 {
+		t.Errorf("got VWAP %v, want typical price 10", got[0])
+	}
+}
+
+// vwapColumn returns VWAP column of data rows written with DefaultWriter and VWAP
+func vwapColumn(t *testing.T, fileName string) []float64 {
+	t.Helper()
+	var result []float64
+	for _, line := range readLines(t, fileName)[1:] {
+		fields := strings.Split(line, ",")
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+func TestVWAPContinuesAcrossWrites(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "SBER.txt")
+	writer := DefaultWriter()
+	writer.VWAP = true
+	opts := ProcessOptions{Writer: writer}
+	data := vwapCandles()
+
+	o, err := createOutput(fileName, opts, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ohlc := range data[:2] {
+		if err := o.write([]OHLCV{ohlc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.commit(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resumed run appends the next candles of the same session
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err = createOutput(fileName, opts, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := OHLCV{Date: data[1].Date.Add(time.Minute), High: 12, Low: 12, Close: 12, Volume: 60}
+	if err := o.write([]OHLCV{next, data[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.commit(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	got := vwapColumn(t, fileName)
+	want := []float64{10, 13, (10*10 + 14*30 + 12*60) / 100.0, 20}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("row %d: got VWAP %v, want %v", i, got[i], want[i])
+		}
+	}
+}
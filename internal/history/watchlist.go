@@ -0,0 +1,134 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// watchlistColumns are columns of watchlist CSV file
+var watchlistColumns = []string{"ticker", "kind", "engine", "market", "board", "interval", "from_year", "to_year", "output"}
+
+// LoadWatchlistCSV reads CSV file listing instruments one per row, e.g.
+//
+//	ticker,kind,engine,market,board,interval,from_year,to_year
+//	SBER,shares,stock,shares,TQBR,24,2020,2024
+//	Si,futures,,,,1,2023,
+//
+// Header row is required, only ticker column is mandatory, lines starting
+// with # are ignored. Omitted kind is inferred from engine, see JobSpec.Kind.
+// Omitted coordinates are left empty to use processor
+// defaults, omitted interval means 1 minute candles, omitted to_year means
+// the current year and omitted from_year means to_year. Rows differing by
+// ticker only are combined into a single job.
+func LoadWatchlistCSV(path string) ([]JobSpec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open watchlist")
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read watchlist header")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["ticker"]; !ok {
+		return nil, errors.New("watchlist has no ticker column")
+	}
+
+	var jobs []JobSpec
+	// jobs indexes by their coordinates, range, interval and output
+	indx := make(map[string]int)
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read watchlist row")
+		}
+
+		values := make(map[string]string, len(watchlistColumns))
+		for _, name := range watchlistColumns {
+			if i, ok := columns[name]; ok && i < len(row) {
+				values[name] = strings.TrimSpace(row[i])
+			}
+		}
+
+		ticker := values["ticker"]
+		if ticker == "" {
+			continue
+		}
+		job, err := watchlistJob(values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "watchlist line %d", line)
+		}
+
+		key := fmt.Sprintf("%+v", job)
+		if i, ok := indx[key]; ok {
+			jobs[i].Tickers = append(jobs[i].Tickers, ticker)
+			continue
+		}
+		indx[key] = len(jobs)
+		job.Tickers = []string{ticker}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// watchlistJob builds job of watchlist row values without tickers
+func watchlistJob(values map[string]string) (JobSpec, error) {
+	job := JobSpec{
+		Kind:     values["kind"],
+		Engine:   values["engine"],
+		Market:   values["market"],
+		Board:    values["board"],
+		Interval: IntervalMinute1,
+		ToYear:   time.Now().Year(),
+		Output:   values["output"],
+	}
+
+	if err := ValidateJobKind(job.Kind); err != nil {
+		return job, err
+	}
+
+	var err error
+	if value := values["interval"]; value != "" {
+		if job.Interval, err = strconv.Atoi(value); err != nil {
+			return job, errors.Wrap(err, "parse interval")
+		}
+	}
+	if err := ValidateInterval(job.Interval); err != nil {
+		return job, err
+	}
+
+	if value := values["to_year"]; value != "" {
+		if job.ToYear, err = strconv.Atoi(value); err != nil {
+			return job, errors.Wrap(err, "parse to_year")
+		}
+	}
+	job.FromYear = job.ToYear
+	if value := values["from_year"]; value != "" {
+		if job.FromYear, err = strconv.Atoi(value); err != nil {
+			return job, errors.Wrap(err, "parse from_year")
+		}
+	}
+
+	return job, nil
+}
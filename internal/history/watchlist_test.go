@@ -0,0 +1,59 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadWatchlistCSV(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "watchlist.csv")
+	content := `ticker,kind,engine,market,board,interval,from_year,to_year
+# shares of the main board
+SBER,,stock,shares,TQBR,24,2020,2024
+GAZP,,stock,shares,TQBR,24,2020,2024
+Si,futures,,,,,2023,
+RI
+USD000UTSTOM,shares,currency,selt,,60,,2022
+`
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := LoadWatchlistCSV(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	year := time.Now().Year()
+	want := []JobSpec{
+		{Engine: "stock", Market: "shares", Board: "TQBR", Tickers: []string{"SBER", "GAZP"}, Interval: IntervalDay, FromYear: 2020, ToYear: 2024},
+		{Kind: JobFutures, Tickers: []string{"Si"}, Interval: IntervalMinute1, FromYear: 2023, ToYear: year},
+		{Tickers: []string{"RI"}, Interval: IntervalMinute1, FromYear: year, ToYear: year},
+		{Kind: JobShares, Engine: "currency", Market: "selt", Tickers: []string{"USD000UTSTOM"}, Interval: IntervalHour, FromYear: 2022, ToYear: 2022},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", jobs, want)
+	}
+	if jobs[2].JobKind() != JobFutures {
+		t.Errorf("got kind %s of row without engine, want futures", jobs[2].JobKind())
+	}
+}
+
+func TestLoadWatchlistCSVErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"no ticker column": "engine,market\nstock,shares\n",
+		"bad interval":     "ticker,interval\nSBER,5\n",
+		"bad kind":         "ticker,kind\nSBER,bonds\n",
+	} {
+		fileName := filepath.Join(t.TempDir(), "watchlist.csv")
+		if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadWatchlistCSV(fileName); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package history
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDateFormat = "20060102"
+	DefaultTimeFormat = "15:04:05"
+)
+
+// Writer configures text layout of candles output.
+// Zero Delimiter means comma, empty DateFormat and TimeFormat
+// mean DefaultDateFormat and DefaultTimeFormat.
+type Writer struct {
+	Delimiter   rune
+	WriteHeader bool
+	// Header replaces default column names line when not empty
+	Header string
+	// Contract prepends <CONTRACT> column with candle ticker,
+	// used to tell apart series of one futures root in a single file
+	Contract bool
+
+	DateFormat string
+	TimeFormat string
+	// OmitTime drops <TIME> column, processors drop it for daily and
+	// longer intervals unless KeepTime is set
+	OmitTime bool
+	KeepTime bool
+	// Location is the time zone <DATE> and <TIME> columns are written in,
+	// nil means Moscow exchange time. Processors default it to the time zone
+	// of Fetcher, UTC with ParseUTC, to keep ISS wall clock.
+	Location *time.Location
+	// Epoch replaces <DATE> and <TIME> columns with <TIMESTAMP> column
+	// of Unix epoch seconds
+	Epoch bool
+	// VWAP appends <VWAP> column with session volume weighted average price
+	VWAP bool
+	// AdjClose appends <ADJ_CLOSE> column with adjusted close, raw close
+	// is written for candles without adjustment
+	AdjClose bool
+	// Decimals is a fixed number of price decimals, e.g. matching instrument
+	// tick size. Zero means the shortest representation read back exactly.
+	Decimals int
+	// TickerDecimals overrides Decimals for particular tickers
+	TickerDecimals map[string]int
+}
+
+// DefaultWriter returns comma separated MetaStock layout with header
+func DefaultWriter() Writer {
+	return Writer{Delimiter: ',', WriteHeader: true}
+}
+
+func (w Writer) dateFormat() string {
+	if w.DateFormat == "" {
+		return DefaultDateFormat
+	}
+	return w.DateFormat
+}
+
+func (w Writer) timeFormat() string {
+	if w.TimeFormat == "" {
+		return DefaultTimeFormat
+	}
+	return w.TimeFormat
+}
+
+func (w Writer) location() *time.Location {
+	if w.Location == nil {
+		return Moscow
+	}
+	return w.Location
+}
+
+func (w Writer) delimiter() string {
+	if w.Delimiter == 0 {
+		return ","
+	}
+	return string(w.Delimiter)
+}
+
+// HeaderLine returns header line terminated by new line
+func (w Writer) HeaderLine() string {
+	if w.Header != "" {
+		return strings.TrimRight(w.Header, "\r\n") + "\n"
+	}
+	var columns []string
+	if w.Contract {
+		columns = append(columns, "<CONTRACT>")
+	}
+	switch {
+	case w.Epoch:
+		columns = append(columns, "<TIMESTAMP>")
+	case w.OmitTime:
+		columns = append(columns, "<DATE>")
+	default:
+		columns = append(columns, "<DATE>", "<TIME>")
+	}
+	columns = append(columns, "<OPEN>", "<HIGH>", "<LOW>", "<CLOSE>", "<VOL>")
+	if w.VWAP {
+		columns = append(columns, "<VWAP>")
+	}
+	if w.AdjClose {
+		columns = append(columns, "<ADJ_CLOSE>")
+	}
+	return strings.Join(columns, w.delimiter()) + "\n"
+}
+
+// WriteHeaderTo writes header line to out when WriteHeader is enabled
+func (w Writer) WriteHeaderTo(out io.Writer) error {
+	if !w.WriteHeader {
+		return nil
+	}
+	_, err := io.WriteString(out, w.HeaderLine())
+	return err
+}
+
+// Row formats candle as line terminated by new line.
+// Without preceding session candles VWAP equals the candle typical price.
+func (w Writer) Row(ohlc OHLCV) string {
+	return w.row(ohlc, typicalPrice(ohlc))
+}
+
+func (w Writer) row(ohlc OHLCV, vwap float64) string {
+	return strings.Join(w.record(ohlc, vwap), w.delimiter()) + "\n"
+}
+
+// record returns candle columns of writer layout
+func (w Writer) record(ohlc OHLCV, vwap float64) []string {
+	var columns []string
+	if w.Contract {
+		columns = append(columns, ohlc.Ticker)
+	}
+	date := ohlc.Date.In(w.location())
+	switch {
+	case w.Epoch:
+		columns = append(columns, strconv.FormatInt(date.Unix(), 10))
+	case w.OmitTime:
+		columns = append(columns, date.Format(w.dateFormat()))
+	default:
+		columns = append(columns, date.Format(w.dateFormat()), date.Format(w.timeFormat()))
+	}
+	decimals := w.decimals(ohlc.Ticker)
+	columns = append(columns,
+		formatPrice(ohlc.Open, decimals),
+		formatPrice(ohlc.High, decimals),
+		formatPrice(ohlc.Low, decimals),
+		formatPrice(ohlc.Close, decimals),
+		strconv.FormatInt(ohlc.Volume, 10),
+	)
+	if w.VWAP {
+		columns = append(columns, formatPrice(vwap, decimals))
+	}
+	if w.AdjClose {
+		adjClose := ohlc.AdjClose
+		if adjClose == 0 {
+			adjClose = ohlc.Close
+		}
+		columns = append(columns, formatPrice(adjClose, decimals))
+	}
+	return columns
+}
+
+// decimals returns price decimals of ticker, -1 for the shortest exact representation
+func (w Writer) decimals(ticker string) int {
+	if decimals, ok := w.TickerDecimals[ticker]; ok {
+		return decimals
+	}
+	if w.Decimals > 0 {
+		return w.Decimals
+	}
+	return -1
+}
+
+// formatPrice formats price with fixed decimals, or with the shortest exact
+// representation for negative decimals, never using exponent like %g does
+func formatPrice(price float64, decimals int) string {
+	return strconv.FormatFloat(price, 'f', decimals, 64)
+}
+
+// CSVRecord returns candle columns of DefaultWriter layout: date, time,
+// open, high, low, close and volume. All writers share this formatting.
+func (ohlc OHLCV) CSVRecord() []string {
+	return DefaultWriter().record(ohlc, 0)
+}
+
+// String returns candle as DefaultWriter row without line ending
+func (ohlc OHLCV) String() string {
+	return strings.Join(ohlc.CSVRecord(), ",")
+}
+
+// WriteRows writes candles to out line by line. VWAP accumulation starts
+// over with every call, see SessionVWAP.
+func (w Writer) WriteRows(out io.Writer, data []OHLCV) error {
+	return w.writeRows(out, data, &vwapSession{})
+}
+
+// writeRows writes candles continuing VWAP accumulation of session
+func (w Writer) writeRows(out io.Writer, data []OHLCV, session *vwapSession) error {
+	for _, ohlc := range data {
+		price := typicalPrice(ohlc)
+		if w.VWAP {
+			price = session.add(ohlc)
+		}
+		if _, err := io.WriteString(out, w.row(ohlc, price)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEpochMatchesMoscowInstant(t *testing.T) {
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader, "1;1;1;1;0;1;2024-07-01 10:00:00;2024-07-01 10:00:59"))
+	})
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	data, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := DefaultWriter()
+	writer.Epoch = true
+	if got := writer.HeaderLine(); got != "<TIMESTAMP>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n" {
+		t.Errorf("got header %q", got)
+	}
+
+	timestamp, err := strconv.ParseInt(strings.Split(writer.Row(data[0]), ",")[0], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:00 MSK is 07:00 UTC
+	if want := time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC).Unix(); timestamp != want {
+		t.Errorf("got timestamp %d, want %d", timestamp, want)
+	}
+	if timestamp != data[0].Date.Unix() {
+		t.Errorf("got timestamp %d, want parsed instant %d", timestamp, data[0].Date.Unix())
+	}
+}
+
+func TestPricesRoundTripRawCSV(t *testing.T) {
+	// open;close;high;low as ISS sends them
+	raw := [][]string{
+		{"0.00012345", "0.00012346", "0.00012399", "0.0001234"},
+		{"100000", "100050", "100100", "99950"},
+		{"123.456789", "123.4", "124", "0.1"},
+		{"98765.4321", "1234567.891", "1234567.891", "0.000001"},
+	}
+	rows := make([]string, 0, len(raw))
+	for i, prices := range raw {
+		rows = append(rows, fmt.Sprintf("%s;0;1;2024-07-01 10:%02d:00;2024-07-01 10:%02d:59", strings.Join(prices, ";"), i, i))
+	}
+	fetcher := newTestFetcher(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, candlesCSV(candlesHeader, rows...))
+	})
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	data, err := fetcher.Fetch(context.Background(), "stock", "shares", "TQBR", "SBER", day, day, IntervalMinute1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := DefaultWriter()
+	for i, ohlc := range data {
+		columns := strings.Split(strings.TrimSpace(writer.Row(ohlc)), ",")
+		// Row layout is open, high, low, close after date and time
+		want := []string{raw[i][0], raw[i][2], raw[i][3], raw[i][1]}
+		if got := columns[2:6]; strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("row %d: got prices %v, want raw %v", i, got, want)
+		}
+	}
+}
+
+func TestPriceDecimals(t *testing.T) {
+	ohlc := OHLCV{Ticker: "SiH4", Date: moscowTime(2024, 7, 1, 10, 0), Open: 100000, High: 100000.5, Low: 99999.125, Close: 0.00012345}
+
+	writer := DefaultWriter()
+	writer.Decimals = 2
+	if got := writer.Row(ohlc); !strings.Contains(got, ",100000.00,100000.50,99999.12,0.00,") {
+		t.Errorf("got row %q with 2 decimals", got)
+	}
+
+	writer.TickerDecimals = map[string]int{"SiH4": 0}
+	if got := writer.Row(ohlc); !strings.Contains(got, ",100000,100000,99999,0,") {
+		t.Errorf("got row %q with ticker decimals", got)
+	}
+}
+
+func TestCSVRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		ohlc OHLCV
+		want []string
+	}{
+		{
+			name: "minute candle",
+			ohlc: OHLCV{Ticker: "SBER", Date: moscowTime(2024, 1, 10, 10, 5), Open: 270.5, High: 271, Low: 270.1, Close: 270.99, Volume: 1200},
+			want: []string{"20240110", "10:05:00", "270.5", "271", "270.1", "270.99", "1200"},
+		},
+		{
+			name: "small prices without exponent",
+			ohlc: OHLCV{Ticker: "VTBR", Date: moscowTime(2024, 1, 10, 10, 0), Open: 0.00012345, High: 0.0001235, Low: 0.0001234, Close: 0.00012345, Volume: 5},
+			want: []string{"20240110", "10:00:00", "0.00012345", "0.0001235", "0.0001234", "0.00012345", "5"},
+		},
+		{
+			name: "large prices without exponent",
+			ohlc: OHLCV{Ticker: "RI", Date: moscowTime(2024, 1, 10, 18, 59), Open: 100000, High: 1e7, Low: 99999.5, Close: 1234567.25, Volume: 0},
+			want: []string{"20240110", "18:59:00", "100000", "10000000", "99999.5", "1234567.25", "0"},
+		},
+		{
+			name: "instant of another zone is written in Moscow time",
+			ohlc: OHLCV{Date: time.Date(2024, 1, 10, 21, 30, 0, 0, time.UTC), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1},
+			want: []string{"20240111", "00:30:00", "1", "1", "1", "1", "1"},
+		},
+	}
+	for _, test := range tests {
+		got := test.ohlc.CSVRecord()
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if got, want := test.ohlc.String(), strings.Join(test.want, ","); got != want {
+			t.Errorf("%s: got String %q, want %q", test.name, got, want)
+		}
+	}
+}
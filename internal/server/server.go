@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denis-gudim/moex-history-downloader/internal/history"
+)
+
+// Handler serves candles on demand:
+//
+//	GET /candles?engine=stock&market=shares&board=TQBR&ticker=SBER&from=2024-01-01&till=2024-01-31&interval=24
+//
+// Engine and market default to stock shares, empty board selects the first
+// board of history.BoardChain having candles and interval defaults to daily.
+// Candles are streamed page by page as CSV in history.DefaultWriter layout, or
+// as JSON array when Accept header asks for application/json.
+type Handler struct {
+	Fetcher *history.Fetcher
+	mux     *http.ServeMux
+}
+
+// NewHandler returns handler serving candles fetched with fetcher
+func NewHandler(fetcher *history.Fetcher) *Handler {
+	h := &Handler{Fetcher: fetcher, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /candles", h.candles)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// candles fetches and writes candles of the requested ticker
+func (h *Handler) candles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	ticker := query.Get("ticker")
+	if ticker == "" {
+		http.Error(w, "ticker is required", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseDate(query.Get("from"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	till, err := parseDate(query.Get("till"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid till: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	interval := history.IntervalDay
+	if value := query.Get("interval"); value != "" {
+		if interval, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid interval: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	engine := valueOr(query.Get("engine"), history.SharesEngine)
+	market := valueOr(query.Get("market"), history.SharesMarket)
+
+	format := history.FormatCSV
+	w.Header().Set("Content-Type", "text/csv")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		format = history.FormatJSON
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	out := &responseWriter{ResponseWriter: w}
+	err = h.Fetcher.FetchToWriter(r.Context(), engine, market, query.Get("board"), ticker, from, till, interval, out, format)
+	if err == nil {
+		return
+	}
+	if out.written {
+		// Status is already sent, the client sees the response cut off
+		panic(http.ErrAbortHandler)
+	}
+	http.Error(w, err.Error(), errorStatus(err))
+}
+
+// responseWriter records whether anything was written to the response
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// errorStatus returns response status of failed candles request: bad request
+// for invalid parameters, not found when ISS doesn't know the instrument and
+// bad gateway for other ISS failures
+func errorStatus(err error) int {
+	if errors.Is(err, history.ErrInvalidInterval) || errors.Is(err, history.ErrInvalidDateRange) {
+		return http.StatusBadRequest
+	}
+	if code, ok := history.StatusCode(err); ok && code == http.StatusNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+// parseDate parses date of YYYY-MM-DD format
+func parseDate(value string) (time.Time, error) {
+	return time.Parse("2006-01-02", value)
+}
+
+func valueOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/denis-gudim/moex-history-downloader/internal/history"
+)
+
+// issTransport serves ISS requests with handler in process
+type issTransport struct {
+	handler http.HandlerFunc
+}
+
+func (t issTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler(recorder, r)
+	return recorder.Result(), nil
+}
+
+// newTestServer returns candles server fetching from iss handler
+func newTestServer(t *testing.T, iss http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	fetcher := &history.Fetcher{Client: &http.Client{Transport: issTransport{handler: iss}}}
+	srv := httptest.NewServer(NewHandler(fetcher))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// twoCandles serves two SBER minute candles on TQBR
+func twoCandles(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.URL.Path, "/boards/TQBR/securities/SBER/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fmt.Fprint(w, "candles\nopen;close;high;low;value;volume;begin;end\n"+
+		"1;2;3;0.5;0;10;2024-01-10 10:00:00;2024-01-10 10:00:59\n"+
+		"2;3;4;1.5;0;20;2024-01-10 10:01:00;2024-01-10 10:01:59\n")
+}
+
+func get(t *testing.T, url, accept string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestCandlesCSV(t *testing.T) {
+	srv := newTestServer(t, twoCandles)
+
+	resp, body := get(t, srv.URL+"/candles?ticker=SBER&from=2024-01-10&till=2024-01-10&interval=1", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %s %q: %s", resp.Status, resp.Header.Get("Content-Type"), body)
+	}
+	want := "<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n" +
+		"20240110,10:00:00,1,3,0.5,2,10\n20240110,10:01:00,2,4,1.5,3,20\n"
+	if body != want {
+		t.Errorf("got\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestCandlesJSON(t *testing.T) {
+	srv := newTestServer(t, twoCandles)
+
+	resp, body := get(t, srv.URL+"/candles?ticker=SBER&board=TQBR&from=2024-01-10&till=2024-01-10&interval=1", "application/json")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %s %q: %s", resp.Status, resp.Header.Get("Content-Type"), body)
+	}
+	var data []history.OHLCV
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	if len(data) != 2 || data[0].Open != 1 || data[1].Volume != 20 || data[1].Ticker != "SBER" {
+		t.Errorf("got %+v", data)
+	}
+}
+
+func TestCandlesEmptyJSON(t *testing.T) {
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "candles\nopen;close;high;low;value;volume;begin;end\n")
+	})
+
+	_, body := get(t, srv.URL+"/candles?ticker=SBER&board=TQBR&from=2024-01-10&till=2024-01-10", "application/json")
+	if strings.TrimSpace(body) != "[]" {
+		t.Errorf("got %q, want empty array", body)
+	}
+}
+
+func TestCandlesBadRequest(t *testing.T) {
+	srv := newTestServer(t, twoCandles)
+
+	for _, query := range []string{
+		"from=2024-01-10&till=2024-01-10",
+		"ticker=SBER&from=10.01.2024&till=2024-01-10",
+		"ticker=SBER&from=2024-01-10&till=2024-01-10&interval=day",
+		"ticker=SBER&from=2024-01-10&till=2024-01-10&interval=5",
+		"ticker=SBER&from=2024-01-10&till=2024-01-01",
+	} {
+		if resp, body := get(t, srv.URL+"/candles?"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %s: %s", query, resp.Status, body)
+		}
+	}
+}
+
+func TestCandlesUpstreamError(t *testing.T) {
+	for status, want := range map[int]int{
+		http.StatusNotFound:            http.StatusNotFound,
+		http.StatusInternalServerError: http.StatusBadGateway,
+	} {
+		srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+
+		resp, body := get(t, srv.URL+"/candles?ticker=SBER&board=TQBR&from=2024-01-10&till=2024-01-10", "")
+		if resp.StatusCode != want {
+			t.Errorf("ISS %d: got %s, want %d", status, resp.Status, want)
+		}
+		if !strings.Contains(body, "fetch SBER") {
+			t.Errorf("ISS %d: got body %q, want fetch error", status, body)
+		}
+	}
+}